@@ -0,0 +1,58 @@
+package mbox
+
+import (
+	"net/mail"
+	"strings"
+)
+
+type Address struct {
+	Name string
+	Addr string
+}
+
+func (a Address) String() string {
+	if a.Name == "" {
+		return a.Addr
+	}
+	return (&mail.Address{Name: a.Name, Address: a.Addr}).String()
+}
+
+// NormalizeAddress returns the bare address str in the form used to compare
+// addresses: surrounding spaces and angle brackets are removed and the address
+// is lowercased. Domains are case-insensitive and, although RFC 5321 allows
+// the local part to be case-sensitive, mail servers treat it as
+// case-insensitive in practice, so the whole address is lowercased.
+func NormalizeAddress(str string) string {
+	return strings.ToLower(strings.Trim(str, "<> \t"))
+}
+
+func parseAddresses(str string) ([]Address, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+	parser := mail.AddressParser{WordDecoder: &wordDecoder}
+	list, err := parser.ParseList(str)
+	if err != nil {
+		var as []Address
+		for _, a := range parseAddressList(str) {
+			if a = strings.TrimSpace(a); a != "" {
+				as = append(as, Address{Addr: a})
+			}
+		}
+		return as, err
+	}
+	as := make([]Address, 0, len(list))
+	for _, a := range list {
+		as = append(as, Address{Name: a.Name, Addr: a.Address})
+	}
+	return as, nil
+}
+
+func addressStrings(as []Address) []string {
+	list := make([]string, 0, len(as))
+	for _, a := range as {
+		list = append(list, a.Addr)
+	}
+	return list
+}
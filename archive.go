@@ -0,0 +1,169 @@
+package mbox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+var ErrUnknownArchive = errors.New("unknown archive format")
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte("\x1f\x8b")
+	tarMagic  = []byte("ustar")
+)
+
+const tarMagicOffset = 257
+
+// ArchiveEntries returns the names of the regular files of the zip, tar or
+// gzipped tar archive stored at path, in the order they appear in the archive.
+func ArchiveEntries(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rs := bufio.NewReader(f)
+	if isZip(rs) {
+		f.Close()
+		return zipEntries(path)
+	}
+	tr, c, err := openTar(rs, f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer c.Close()
+
+	var list []string
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return list, err
+		}
+		if h.Typeflag == tar.TypeReg {
+			list = append(list, h.Name)
+		}
+	}
+}
+
+// OpenArchiveEntry returns a reader over the entry of the zip, tar or gzipped
+// tar archive stored at path. The format of the archive is detected from its
+// content. The returned reader should be closed by the caller.
+func OpenArchiveEntry(path, entry string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rs := bufio.NewReader(f)
+	if isZip(rs) {
+		f.Close()
+		return openZipEntry(path, entry)
+	}
+	tr, c, err := openTar(rs, f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			c.Close()
+			if errors.Is(err, io.EOF) {
+				err = fmt.Errorf("%s: %w", entry, fs.ErrNotExist)
+			}
+			return nil, err
+		}
+		if h.Typeflag == tar.TypeReg && h.Name == entry {
+			return entryReader{Reader: tr, Closer: c}, nil
+		}
+	}
+}
+
+type entryReader struct {
+	io.Reader
+	io.Closer
+}
+
+func openZipEntry(path, entry string) (io.ReadCloser, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range z.File {
+		if f.Name != entry || f.FileInfo().IsDir() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			z.Close()
+			return nil, err
+		}
+		return entryReader{Reader: r, Closer: z}, nil
+	}
+	z.Close()
+	return nil, fmt.Errorf("%s: %w", entry, fs.ErrNotExist)
+}
+
+func zipEntries(path string) ([]string, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	var list []string
+	for _, f := range z.File {
+		if !f.FileInfo().IsDir() {
+			list = append(list, f.Name)
+		}
+	}
+	return list, nil
+}
+
+func isZip(rs *bufio.Reader) bool {
+	magic, _ := rs.Peek(len(zipMagic))
+	return bytes.Equal(magic, zipMagic)
+}
+
+// openTar returns a tar.Reader over rs, decompressed when gzipped, and a closer
+// releasing the gzip.Reader, if any, and f. f is left open on error.
+func openTar(rs *bufio.Reader, f io.Closer) (*tar.Reader, io.Closer, error) {
+	cs := closers{f}
+	if magic, _ := rs.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		z, err := gzip.NewReader(rs)
+		if err != nil {
+			return nil, nil, err
+		}
+		cs = append(closers{z}, cs...)
+		rs = bufio.NewReader(z)
+	}
+	head, _ := rs.Peek(tarMagicOffset + len(tarMagic))
+	if len(head) < tarMagicOffset+len(tarMagic) || !bytes.Equal(head[tarMagicOffset:], tarMagic) {
+		cs[:len(cs)-1].Close()
+		return nil, nil, ErrUnknownArchive
+	}
+	return tar.NewReader(rs), cs, nil
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var err error
+	for _, c := range cs {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
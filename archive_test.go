@@ -0,0 +1,90 @@
+package mbox
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveEntry(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "mixed.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	var (
+		dir   = t.TempDir()
+		files = map[string]func(io.Writer) error{
+			"mails.zip": func(w io.Writer) error {
+				z := zip.NewWriter(w)
+				z.Create("mails/")
+				f, _ := z.Create("mails/inbox.mbox")
+				f.Write(want)
+				return z.Close()
+			},
+			"mails.tar": func(w io.Writer) error {
+				return writeTar(w, want)
+			},
+			"mails.tar.gz": func(w io.Writer) error {
+				z := gzip.NewWriter(w)
+				if err := writeTar(z, want); err != nil {
+					return err
+				}
+				return z.Close()
+			},
+		}
+	)
+	for name, fn := range files {
+		file := filepath.Join(dir, name)
+		w, err := os.Create(file)
+		if err != nil {
+			t.Fatalf("fail to create archive: %s", err)
+		}
+		if err := fn(w); err != nil {
+			t.Fatalf("%s: fail to write archive: %s", name, err)
+		}
+		w.Close()
+
+		entries, err := ArchiveEntries(file)
+		if err != nil {
+			t.Errorf("%s: fail to list entries: %s", name, err)
+			continue
+		}
+		if got := strings.Join(entries, ","); got != "mails/inbox.mbox" {
+			t.Errorf("%s: entries mismatched! want %s, got %s", name, "mails/inbox.mbox", got)
+		}
+		r, err := OpenArchiveEntry(file, "mails/inbox.mbox")
+		if err != nil {
+			t.Errorf("%s: fail to open entry: %s", name, err)
+			continue
+		}
+		scan := NewScanner(r)
+		if !scan.Scan() {
+			t.Errorf("%s: fail to read message: %s", name, scan.Err())
+		} else if got := scan.Message().Subject(); got != defaultSubject {
+			t.Errorf("%s: wrong subject! want %s, got %s", name, defaultSubject, got)
+		}
+		r.Close()
+
+		if _, err := OpenArchiveEntry(file, "mails/missing.mbox"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: missing entry should not exist! got %v", name, err)
+		}
+	}
+	if _, err := ArchiveEntries(filepath.Join("testdata", "mixed.txt")); !errors.Is(err, ErrUnknownArchive) {
+		t.Errorf("mbox should not be read as an archive! got %v", err)
+	}
+}
+
+func writeTar(w io.Writer, body []byte) error {
+	t := tar.NewWriter(w)
+	t.WriteHeader(&tar.Header{Name: "mails/", Typeflag: tar.TypeDir, Mode: 0o755})
+	t.WriteHeader(&tar.Header{Name: "mails/inbox.mbox", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(body))})
+	t.Write(body)
+	return t.Close()
+}
@@ -0,0 +1,137 @@
+package mbox
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// NameFunc returns the name under which the index-th attachment of a message
+// is stored. Returning an empty string falls back to the default name.
+type NameFunc func(p Part, index int) string
+
+func (m Message) AttachmentsZip(w io.Writer) (int, error) {
+	return m.AttachmentsZipFunc(w, nil)
+}
+
+func (m Message) AttachmentsZipFunc(w io.Writer, fn NameFunc) (int, error) {
+	z := newZipper(w, fn)
+	n, err := z.add(m)
+	if err != nil {
+		return n, err
+	}
+	return n, z.Close()
+}
+
+func MailboxAttachmentsZip(w io.Writer, r io.Reader) (int, error) {
+	return MailboxAttachmentsZipFunc(w, r, nil)
+}
+
+func MailboxAttachmentsZipFunc(w io.Writer, r io.Reader, fn NameFunc) (int, error) {
+	var (
+		z     = newZipper(w, fn)
+		scan  = NewScanner(r)
+		count int
+	)
+	for scan.Scan() {
+		n, err := z.add(scan.Message())
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return count, err
+	}
+	return count, z.Close()
+}
+
+type zipper struct {
+	*zip.Writer
+	name NameFunc
+	seen map[string]struct{}
+}
+
+func newZipper(w io.Writer, fn NameFunc) *zipper {
+	return &zipper{
+		Writer: zip.NewWriter(w),
+		name:   fn,
+		seen:   make(map[string]struct{}),
+	}
+}
+
+func (z *zipper) add(m Message) (int, error) {
+	var count int
+	for _, p := range m.Parts {
+		if !p.IsAttachment() {
+			continue
+		}
+		w, err := z.Create(z.uniqueName(z.attachmentName(p, count)))
+		if err != nil {
+			return count, err
+		}
+		if _, err := w.Write(p.Bytes()); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (z *zipper) attachmentName(p Part, index int) string {
+	if z.name != nil {
+		if name := z.name(p, index); name != "" {
+			return name
+		}
+	}
+	return attachmentName(p, index)
+}
+
+func (z *zipper) uniqueName(name string) string {
+	var (
+		ext  = path.Ext(name)
+		base = strings.TrimSuffix(name, ext)
+		str  = name
+	)
+	for i := 1; ; i++ {
+		if _, ok := z.seen[str]; !ok {
+			break
+		}
+		str = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	z.seen[str] = struct{}{}
+	return str
+}
+
+func attachmentName(p Part, index int) string {
+	if name := sanitizeFilename(p.Filename()); name != "" {
+		return name
+	}
+	name := fmt.Sprintf("attachment-%d", index+1)
+	if es, _ := mime.ExtensionsByType(p.SniffedType()); len(es) > 0 {
+		name += es[0]
+	}
+	return name
+}
+
+func sanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if ix := strings.LastIndex(name, "/"); ix >= 0 {
+		name = name[ix+1:]
+	}
+	return sanitizeName(name)
+}
+
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.Trim(name, ". ")
+}
@@ -0,0 +1,158 @@
+package mbox
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentsZip(t *testing.T) {
+	m, err := openMessage("mixed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	other := m.Parts[1]
+	other.Header = make(Header)
+	other.Set("content-disposition", `attachment; filename="../../etc/sample.go"`)
+	m.Parts = append(m.Parts, other)
+
+	var buf bytes.Buffer
+	n, err := m.AttachmentsZip(&buf)
+	if err != nil {
+		t.Fatalf("fail to write zip: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("wrong number of attachments! want %d, got %d", 2, n)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("fail to read zip: %s", err)
+	}
+	names := []string{"sample.go", "sample-1.go"}
+	if len(z.File) != len(names) {
+		t.Fatalf("wrong number of files! want %d, got %d", len(names), len(z.File))
+	}
+	for i, f := range z.File {
+		if f.Name != names[i] {
+			t.Errorf("wrong filename! want %s, got %s", names[i], f.Name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("%s: fail to open file: %s", f.Name, err)
+		}
+		bs, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: fail to read file: %s", f.Name, err)
+		}
+		if want := m.Parts[i+1].Bytes(); !bytes.Equal(bs, want) {
+			t.Errorf("%s: content mismatched! want %q, got %q", f.Name, want, bs)
+		}
+	}
+}
+
+func TestAttachmentsZipFunc(t *testing.T) {
+	m, err := openMessage("mixed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	other := m.Parts[1]
+	other.Header = make(Header)
+	other.Set("content-disposition", "attachment")
+	m.Parts = append(m.Parts, other)
+
+	name := func(p Part, index int) string {
+		if p.Filename() == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s/%d-%s", m.Date().Format("2006-01-02"), index, p.Filename())
+	}
+	var buf bytes.Buffer
+	if _, err := m.AttachmentsZipFunc(&buf, name); err != nil {
+		t.Fatalf("fail to write zip: %s", err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("fail to read zip: %s", err)
+	}
+	if len(z.File) != 2 {
+		t.Fatalf("wrong number of files! want %d, got %d", 2, len(z.File))
+	}
+	if want := "2020-01-22/0-sample.go"; z.File[0].Name != want {
+		t.Errorf("wrong filename! want %s, got %s", want, z.File[0].Name)
+	}
+	if want := "attachment-2"; !strings.HasPrefix(z.File[1].Name, want) {
+		t.Errorf("wrong default filename! want %s, got %s", want, z.File[1].Name)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	data := []struct {
+		Input string
+		Want  string
+	}{
+		{Input: "report.pdf", Want: "report.pdf"},
+		{Input: "../../etc/passwd", Want: "passwd"},
+		{Input: `C:\Users\foo\report.pdf`, Want: "report.pdf"},
+		{Input: "what?.txt", Want: "what_.txt"},
+		{Input: "..", Want: ""},
+	}
+	for _, d := range data {
+		if got := sanitizeFilename(d.Input); got != d.Want {
+			t.Errorf("%s: wrong filename! want %q, got %q", d.Input, d.Want, got)
+		}
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "inline.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	want := [][]string{
+		nil,
+		{"report.pdf"},
+		{"notes.txt"},
+	}
+	types := [][]string{
+		nil,
+		{"application/pdf"},
+		{"text/plain"},
+	}
+	var (
+		scan = NewScanner(r)
+		i    int
+	)
+	for ; scan.Scan(); i++ {
+		m := scan.Message()
+		if i >= len(want) {
+			t.Fatalf("too many messages")
+		}
+		var files []string
+		for _, p := range m.Attachments() {
+			files = append(files, p.Filename())
+		}
+		if strings.Join(files, ",") != strings.Join(want[i], ",") {
+			t.Errorf("%s: attachments mismatched! want %v, got %v", m.Subject(), want[i], files)
+		}
+		if got, want := strings.Join(m.AttachmentTypes(), ","), strings.Join(types[i], ","); got != want {
+			t.Errorf("%s: attachment types mismatched! want %s, got %s", m.Subject(), want, got)
+		}
+		if got := m.HasAttachments(); got != (len(want[i]) > 0) {
+			t.Errorf("%s: has attachments mismatched! want %t, got %t", m.Subject(), len(want[i]) > 0, got)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if i != len(want) {
+		t.Errorf("wrong number of messages! want %d, got %d", len(want), i)
+	}
+}
@@ -0,0 +1,87 @@
+package mbox
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	hdrAuthResults = "Authentication-Results"
+
+	authSPF   = "spf"
+	authDKIM  = "dkim"
+	authDMARC = "dmarc"
+	authNone  = "none"
+)
+
+// SPF returns the result (pass, fail, softfail, none,...) of the SPF check
+// recorded in the topmost Authentication-Results header.
+func (m Message) SPF() string {
+	return m.authResult(authSPF)
+}
+
+// DKIM returns the result of the DKIM check recorded in the topmost
+// Authentication-Results header.
+func (m Message) DKIM() string {
+	return m.authResult(authDKIM)
+}
+
+// DMARC returns the result of the DMARC check recorded in the topmost
+// Authentication-Results header.
+func (m Message) DMARC() string {
+	return m.authResult(authDMARC)
+}
+
+// AuthServer returns the identifier, usually the domain, of the server that
+// added the topmost Authentication-Results header.
+func (m Message) AuthServer() string {
+	server, _ := m.authResults()
+	return server
+}
+
+func (m Message) authResult(method string) string {
+	_, results := m.authResults()
+	if res, ok := results[method]; ok {
+		return res
+	}
+	return authNone
+}
+
+func (m Message) authResults() (string, map[string]string) {
+	vs := m.Values(hdrAuthResults)
+	if len(vs) == 0 {
+		return "", nil
+	}
+	return parseAuthResults(vs[0])
+}
+
+var authEqual = regexp.MustCompile(`\s*=\s*`)
+
+func parseAuthResults(str string) (string, map[string]string) {
+	results := make(map[string]string)
+
+	str = authEqual.ReplaceAllString(stripComments(str), "=")
+	parts := strings.Split(str, ";")
+	server := strings.Fields(parts[0])
+	if len(server) == 0 {
+		return "", results
+	}
+	for _, p := range parts[1:] {
+		fields := strings.Fields(p)
+		if len(fields) == 0 {
+			continue
+		}
+		method, res, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		if ix := strings.Index(method, "/"); ix >= 0 {
+			method = method[:ix]
+		}
+		method = strings.ToLower(strings.TrimSpace(method))
+		if _, ok := results[method]; !ok {
+			results[method] = strings.ToLower(strings.TrimSpace(res))
+		}
+	}
+	return strings.ToLower(server[0]), results
+}
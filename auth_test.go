@@ -0,0 +1,86 @@
+package mbox
+
+import (
+	"testing"
+)
+
+func TestAuthResults(t *testing.T) {
+	data := []struct {
+		File   string
+		Server string
+		SPF    string
+		DKIM   string
+		DMARC  string
+	}{
+		{
+			File:   "auth.txt",
+			Server: "mx.foobar.org",
+			SPF:    "pass",
+			DKIM:   "fail",
+			DMARC:  "pass",
+		},
+		{
+			File:  "simple.txt",
+			SPF:   "none",
+			DKIM:  "none",
+			DMARC: "none",
+		},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if got := m.AuthServer(); got != d.Server {
+			t.Errorf("%s: server mismatched! want %s, got %s", d.File, d.Server, got)
+		}
+		if got := m.SPF(); got != d.SPF {
+			t.Errorf("%s: spf mismatched! want %s, got %s", d.File, d.SPF, got)
+		}
+		if got := m.DKIM(); got != d.DKIM {
+			t.Errorf("%s: dkim mismatched! want %s, got %s", d.File, d.DKIM, got)
+		}
+		if got := m.DMARC(); got != d.DMARC {
+			t.Errorf("%s: dmarc mismatched! want %s, got %s", d.File, d.DMARC, got)
+		}
+	}
+}
+
+func TestParseAuthResults(t *testing.T) {
+	data := []struct {
+		Input  string
+		Server string
+		Want   map[string]string
+	}{
+		{
+			Input:  "mx.foobar.org 1; none",
+			Server: "mx.foobar.org",
+			Want:   map[string]string{},
+		},
+		{
+			Input:  "mx.foobar.org; dkim/1=pass header.d=a.org; dkim=fail header.d=b.org",
+			Server: "mx.foobar.org",
+			Want:   map[string]string{"dkim": "pass"},
+		},
+		{
+			Input:  "(comment) mx.foobar.org; spf = neutral",
+			Server: "mx.foobar.org",
+			Want:   map[string]string{"spf": "neutral"},
+		},
+	}
+	for _, d := range data {
+		server, got := parseAuthResults(d.Input)
+		if server != d.Server {
+			t.Errorf("%s: server mismatched! want %s, got %s", d.Input, d.Server, server)
+		}
+		if len(got) != len(d.Want) {
+			t.Errorf("%s: results mismatched! want %v, got %v", d.Input, d.Want, got)
+			continue
+		}
+		for k, v := range d.Want {
+			if got[k] != v {
+				t.Errorf("%s: %s mismatched! want %s, got %s", d.Input, k, v, got[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+)
+
+// base64Reader decodes a base64 stream without any limit on the length of its
+// lines. Whitespaces are ignored wherever they appear and each padded quantum
+// is decoded on its own so that streams made of several concatenated base64
+// blocks decode as a whole.
+type base64Reader struct {
+	r   io.Reader
+	buf []byte
+	in  []byte
+	out []byte
+	pos int64
+	err error
+}
+
+func newBase64Reader(r io.Reader) io.Reader {
+	return &base64Reader{
+		r:   r,
+		buf: make([]byte, 32<<10),
+	}
+}
+
+func (b *base64Reader) Read(p []byte) (int, error) {
+	for len(b.out) == 0 {
+		if b.err != nil {
+			if b.err == io.EOF && len(b.in) > 0 {
+				b.err = base64.CorruptInputError(b.pos)
+			}
+			return 0, b.err
+		}
+		n, err := b.r.Read(b.buf)
+		for _, c := range b.buf[:n] {
+			switch c {
+			case ' ', '\t', '\r', '\n':
+			default:
+				b.in = append(b.in, c)
+			}
+		}
+		b.err = err
+		if err := b.decode(); err != nil {
+			b.err = err
+		}
+	}
+	n := copy(p, b.out)
+	b.out = b.out[n:]
+	return n, nil
+}
+
+func (b *base64Reader) decode() error {
+	size := len(b.in) / 4 * 4
+	for size > 0 {
+		end := size
+		if ix := bytes.IndexByte(b.in[:size], '='); ix >= 0 {
+			end = (ix/4 + 1) * 4
+		}
+		dst := make([]byte, base64.StdEncoding.DecodedLen(end))
+		n, err := base64.StdEncoding.Decode(dst, b.in[:end])
+		b.out = append(b.out, dst[:n]...)
+		if err != nil {
+			if e, ok := err.(base64.CorruptInputError); ok {
+				return base64.CorruptInputError(b.pos + int64(e))
+			}
+			return err
+		}
+		b.in = b.in[end:]
+		b.pos += int64(end)
+		size -= end
+	}
+	b.in = append(b.in[:0], b.in...)
+	return nil
+}
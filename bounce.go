@@ -0,0 +1,73 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	hdrFinalRecipient    = "Final-Recipient"
+	hdrOriginalRecipient = "Original-Recipient"
+	hdrAction            = "Action"
+)
+
+// BouncedRecipients returns the addresses of the recipients for which the
+// delivery failed, as reported by the message/delivery-status parts of a
+// delivery status notification (RFC 3464). Both the Final-Recipient and the
+// Original-Recipient of a failed recipient are returned.
+func (m Message) BouncedRecipients() []string {
+	var (
+		list []string
+		seen = make(map[string]struct{})
+	)
+	for _, p := range m.bodyParts() {
+		if main, sub := p.ContentType(); main != "message" || (sub != "delivery-status" && sub != "global-delivery-status") {
+			continue
+		}
+		for _, addr := range failedRecipients(p.decodeBody()) {
+			key := strings.ToLower(addr)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			list = append(list, addr)
+		}
+	}
+	return list
+}
+
+func failedRecipients(body []byte) []string {
+	var (
+		list []string
+		rs   = textproto.NewReader(bufio.NewReader(bytes.NewReader(body)))
+	)
+	for {
+		hdr, err := rs.ReadMIMEHeader()
+		if action := strings.ToLower(hdr.Get(hdrAction)); action == "" || action == "failed" {
+			for _, k := range []string{hdrFinalRecipient, hdrOriginalRecipient} {
+				if addr := recipientAddress(hdr.Get(k)); addr != "" {
+					list = append(list, addr)
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return list
+}
+
+// recipientAddress returns the address of a recipient field given as
+// "address-type; address". Only the rfc822 addresses are returned.
+func recipientAddress(str string) string {
+	kind, addr, ok := strings.Cut(str, ";")
+	if !ok {
+		kind, addr = "rfc822", kind
+	}
+	if !strings.EqualFold(strings.TrimSpace(kind), "rfc822") {
+		return ""
+	}
+	return strings.Trim(addr, "<> \t")
+}
@@ -0,0 +1,28 @@
+package mbox
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBouncedRecipients(t *testing.T) {
+	data := []struct {
+		File string
+		Want []string
+	}{
+		{File: "dsn.txt", Want: []string{"alice@foobar.org", "bob@example.org", "bob.forward@foobar.org"}},
+		{File: "simple.txt"},
+		{File: "mixed.txt"},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", d.File, err)
+			continue
+		}
+		got := m.BouncedRecipients()
+		if strings.Join(got, ",") != strings.Join(d.Want, ",") {
+			t.Errorf("%s: recipients mismatched! want %v, got %v", d.File, d.Want, got)
+		}
+	}
+}
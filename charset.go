@@ -0,0 +1,87 @@
+package mbox
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const charsetASCII = "us-ascii"
+
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// registeredCharsets lists the common charsets registered by IANA that are not
+// decoded by decodeCharset.
+var registeredCharsets = map[string]struct{}{
+	"iso-8859-2": {}, "iso-8859-3": {}, "iso-8859-4": {}, "iso-8859-5": {},
+	"iso-8859-6": {}, "iso-8859-7": {}, "iso-8859-8": {}, "iso-8859-9": {},
+	"iso-8859-10": {}, "iso-8859-13": {}, "iso-8859-14": {}, "iso-8859-15": {},
+	"iso-8859-16": {}, "windows-1250": {}, "windows-1251": {}, "windows-1253": {},
+	"windows-1254": {}, "windows-1255": {}, "windows-1256": {}, "windows-1257": {},
+	"windows-1258": {}, "koi8-r": {}, "koi8-u": {}, "ibm437": {}, "ibm850": {},
+	"macintosh": {}, "utf-7": {}, "utf-16": {}, "utf-16be": {}, "utf-16le": {},
+	"utf-32": {}, "utf-32be": {}, "utf-32le": {}, "shift_jis": {}, "euc-jp": {},
+	"iso-2022-jp": {}, "euc-kr": {}, "iso-2022-kr": {}, "gb2312": {}, "gbk": {},
+	"gb18030": {}, "big5": {}, "tis-620": {},
+}
+
+// registeredCharset reports whether charset is a charset registered by IANA,
+// decoded or not by decodeCharset.
+func registeredCharset(charset string) bool {
+	if _, err := decodeCharset(charset, nil); err == nil {
+		return true
+	}
+	_, ok := registeredCharsets[strings.ToLower(strings.TrimSpace(charset))]
+	return ok
+}
+
+func decodeCharset(charset string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8":
+		return body, nil
+	case charsetASCII, "ascii":
+		return decodeASCII(body), nil
+	case "iso-8859-1", "latin1", "latin-1", "iso8859-1":
+		return decodeSingleByte(body, nil), nil
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(body, cp1252[:]), nil
+	default:
+		return body, fmt.Errorf("%s: unsupported charset", charset)
+	}
+}
+
+func decodeSingleByte(body []byte, table []rune) []byte {
+	buf := make([]byte, 0, len(body))
+	for _, b := range body {
+		if b < utf8.RuneSelf {
+			buf = append(buf, b)
+			continue
+		}
+		r := rune(b)
+		if table != nil && b >= 0x80 && b < 0xa0 {
+			r = table[b-0x80]
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf
+}
+
+func decodeASCII(body []byte) []byte {
+	ix := bytes.IndexFunc(body, func(r rune) bool { return r >= utf8.RuneSelf })
+	if ix < 0 {
+		return body
+	}
+	buf := append([]byte{}, body[:ix]...)
+	for _, b := range body[ix:] {
+		if b < utf8.RuneSelf {
+			buf = append(buf, b)
+			continue
+		}
+		buf = utf8.AppendRune(buf, utf8.RuneError)
+	}
+	return buf
+}
@@ -27,14 +27,19 @@ func main() {
 	extended := flag.Bool("x", false, "include extended headers")
 	clean := flag.Bool("c", false, "clean header values")
 	uniq := flag.Bool("u", false, "filter uniq message")
+	tree := flag.Bool("tree", false, "print the structure of the message")
 	flag.Parse()
 
-	r, err := os.Open(flag.Arg(0))
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	var r io.Reader = os.Stdin
+	if file := flag.Arg(0); file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		r = f
 	}
-	defer r.Close()
 
 	var (
 		rs   = bufio.NewReader(r)
@@ -63,6 +68,10 @@ func main() {
 		}
 		fmt.Println(mid)
 
+		if *tree {
+			dumpTree(m)
+			continue
+		}
 		dumpMessage(m, fs, *extended, *clean)
 	}
 }
@@ -94,55 +103,87 @@ func listFields(args []string) []string {
 }
 
 func dumpMessage(m mbox.Message, fields []string, extended, clean bool) {
-	dumpHeader(m.Header, fields, extended, clean, "")
-	if len(m.Parts) == 0 {
+	if len(fields) == 0 {
+		dumpAll(m, extended, clean)
 		return
 	}
+	dumpHeader(m.Header, fields, clean, "")
 	for _, p := range m.Parts {
 		if len(p.Header) == 0 {
 			continue
 		}
-		dumpHeader(p.Header, fields, extended, clean, "> ")
+		dumpHeader(p.Header, fields, clean, "> ")
 	}
 }
 
-func dumpHeader(hdr mbox.Header, fields []string, extended, clean bool, prefix string) {
-	if len(fields) == 0 {
-		dumpAll(hdr, extended, clean, prefix)
-		return
+func dumpTree(m mbox.Message) {
+	root := mbox.Part{Header: m.Header}
+	if ct := root.DeclaredType(); ct != "" {
+		fmt.Println(ct)
+	} else {
+		fmt.Println("text/plain")
 	}
-	for _, f := range fields {
-		vs := hdr[f]
-		if len(vs) == 0 {
-			continue
+	m.WalkParts(func(p mbox.Part, depth int) error {
+		var (
+			indent = strings.Repeat("  ", depth+1)
+			mtype  = p.DeclaredType()
+			enc    = p.Get("content-transfer-encoding")
+			dispo  = p.Get("content-disposition")
+		)
+		if mtype == "" {
+			mtype = "text/plain"
 		}
-		for _, v := range vs {
-			if v == "" {
-				continue
-			}
-			if clean {
-				v = cleanValue(v)
-			}
-			fmt.Printf("%s%-16s: %s\n", prefix, f, v)
+		if p.IsMultipart() {
+			fmt.Printf("%s%s %s\n", indent, p.Path(), mtype)
+			return nil
+		}
+		if enc == "" {
+			enc = "7bit"
+		}
+		if ix := strings.Index(dispo, ";"); ix >= 0 {
+			dispo = dispo[:ix]
+		}
+		if dispo == "" {
+			dispo = "-"
+		}
+		fmt.Printf("%s%s %s [%s, %s] %d bytes", indent, p.Path(), mtype, enc, dispo, p.Size())
+		if file := p.Filename(); file != "" {
+			fmt.Printf(" %q", file)
+		}
+		fmt.Println()
+		return nil
+	})
+}
+
+func dumpHeader(hdr mbox.Header, fields []string, clean bool, prefix string) {
+	for _, f := range fields {
+		for _, v := range hdr[f] {
+			dumpField(f, v, clean, prefix)
 		}
 	}
 }
 
-func dumpAll(hdr mbox.Header, extended, clean bool, prefix string) {
-	for k, vs := range hdr {
-		if !extended && strings.HasPrefix(strings.ToLower(k), "x-") {
-			continue
+func dumpAll(m mbox.Message, extended, clean bool) {
+	m.Each(func(field, value string) {
+		prefix := ""
+		if ix := strings.Index(field, "/"); ix >= 0 {
+			prefix, field = "> ", field[ix+1:]
 		}
-		for _, v := range vs {
-			if v == "" {
-				continue
-			}
-			if clean {
-				v = cleanValue(v)
-			}
-			fmt.Printf("%s%-16s: %s\n", prefix, k, v)
+		if !extended && strings.HasPrefix(strings.ToLower(field), "x-") {
+			return
 		}
+		dumpField(field, value, clean, prefix)
+	})
+}
+
+func dumpField(field, value string, clean bool, prefix string) {
+	if value == "" {
+		return
+	}
+	if clean {
+		value = cleanValue(value)
 	}
+	fmt.Printf("%s%-16s: %s\n", prefix, field, value)
 }
 
 func cleanValue(str string) string {
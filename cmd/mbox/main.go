@@ -1,14 +1,20 @@
 package main
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/textproto"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/midbel/mbox"
 )
@@ -45,17 +51,202 @@ func (d *Date) String() string {
 	if d.IsZero() {
 		return "yyyy-mm-dd"
 	}
-	return d.Format("2006-02-01")
+	return d.Format("2006-01-02")
 }
 
 type FilterFunc func(mbox.Message) bool
 
+type Headers []FilterFunc
+
+func (h *Headers) String() string {
+	return "key[=pattern]"
+}
+
+func (h *Headers) Set(str string) error {
+	k, v, _ := strings.Cut(str, "=")
+	if k = strings.TrimSpace(k); k == "" {
+		return fmt.Errorf("%s: missing header name", str)
+	}
+	*h = append(*h, withHeader(k, v))
+	return nil
+}
+
+type Printer interface {
+	Print(int, mbox.Message) error
+	Flush() error
+}
+
+type PrintFunc func(int, mbox.Message) error
+
+func (p PrintFunc) Print(mail int, m mbox.Message) error {
+	return p(mail, m)
+}
+
+func (p PrintFunc) Flush() error {
+	return nil
+}
+
+type statsPrinter struct {
+	mbox.Stats
+}
+
+func (s *statsPrinter) Print(_ int, m mbox.Message) error {
+	s.Add(m)
+	return nil
+}
+
+func (s *statsPrinter) Flush() error {
+	var first, last string
+	if !s.First.IsZero() {
+		first = s.First.Format("2006-01-02 15:04:05")
+	}
+	if !s.Last.IsZero() {
+		last = s.Last.Format("2006-01-02 15:04:05")
+	}
+	fmt.Printf("%-16s: %d\n", "messages", s.Count)
+	fmt.Printf("%-16s: %d\n", "replies", s.Replies)
+	fmt.Printf("%-16s: %d\n", "with attachments", s.WithAttachments)
+	fmt.Printf("%-16s: %d\n", "attachment bytes", s.AttachmentBytes)
+	fmt.Printf("%-16s: %d\n", "senders", len(s.Senders))
+	fmt.Printf("%-16s: %s\n", "first", first)
+	_, err := fmt.Printf("%-16s: %s\n", "last", last)
+	return err
+}
+
+type dupesPrinter struct {
+	messages []mbox.Message
+}
+
+func (d *dupesPrinter) Print(_ int, m mbox.Message) error {
+	d.messages = append(d.messages, m)
+	return nil
+}
+
+func (d *dupesPrinter) Flush() error {
+	for _, is := range mbox.FindDuplicates(d.messages) {
+		mails := make([]string, len(is))
+		for j, i := range is {
+			mails[j] = strconv.Itoa(i + 1)
+		}
+		m := d.messages[is[0]]
+		if _, err := fmt.Printf("%s | %s | %s\n", strings.Join(mails, ","), m.From(), m.Subject()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errLimit = errors.New("limit reached")
+
+type limitPrinter struct {
+	Printer
+	skip int
+	head int
+	seen int
+}
+
+func (p *limitPrinter) Print(mail int, m mbox.Message) error {
+	if p.seen++; p.seen <= p.skip {
+		return nil
+	}
+	if err := p.Printer.Print(mail, m); err != nil {
+		return err
+	}
+	if p.head > 0 && p.seen-p.skip >= p.head {
+		return errLimit
+	}
+	return nil
+}
+
+type tailPrinter struct {
+	Printer
+	size     int
+	mails    []int
+	messages []mbox.Message
+}
+
+func (p *tailPrinter) Print(mail int, m mbox.Message) error {
+	p.mails = append(p.mails, mail)
+	p.messages = append(p.messages, m)
+	if len(p.messages) > p.size {
+		p.mails, p.messages = p.mails[1:], p.messages[1:]
+	}
+	return nil
+}
+
+func (p *tailPrinter) Flush() error {
+	for i, m := range p.messages {
+		if err := p.Printer.Print(p.mails[i], m); err != nil {
+			return err
+		}
+	}
+	return p.Printer.Flush()
+}
+
+type limits struct {
+	skip int
+	head int
+	tail int
+}
+
+func (l limits) wrap(p Printer) Printer {
+	if l.tail > 0 {
+		p = &tailPrinter{Printer: p, size: l.tail}
+	}
+	if l.skip > 0 || l.head > 0 {
+		p = &limitPrinter{Printer: p, skip: l.skip, head: l.head}
+	}
+	return p
+}
+
+type archive struct {
+	list  bool
+	entry string
+}
+
+func (a archive) open(file string) (io.ReadCloser, error) {
+	if a.entry == "" {
+		return os.Open(file)
+	}
+	return mbox.OpenArchiveEntry(file, a.entry)
+}
+
+func listEntries(files []string) error {
+	for _, f := range files {
+		entries, err := mbox.ArchiveEntries(f)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if len(files) > 1 {
+				fmt.Printf("%s: ", f)
+			}
+			fmt.Println(e)
+		}
+	}
+	return nil
+}
+
 func main() {
-	files, keep := parseArgs()
+	files, keep, printer, output, limit, arch := parseArgs()
 
+	if arch.list {
+		if err := listEntries(files); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+	if len(files) == 0 {
+		files = append(files, "-")
+	}
 	rs := make([]io.Reader, len(files))
 	for i := 0; i < len(files); i++ {
-		r, err := os.Open(files[i])
+		if files[i] == "-" {
+			rs[i] = os.Stdin
+			continue
+		}
+		r, err := arch.open(files[i])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(2)
@@ -64,61 +255,272 @@ func main() {
 		rs[i] = r
 	}
 
-	var (
-		r    = bufio.NewReader(io.MultiReader(rs...))
-		mail int
-	)
-	for {
-		m, err := mbox.ReadMessage(r)
+	if output != "" {
+		w, err := os.Create(output)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(2)
 		}
-		if !keep(m) {
-			continue
+		defer w.Close()
+		printer = PrintFunc(writeMessage(w))
+	}
+	printer = limit.wrap(printer)
+
+	var mail int
+files:
+	for i, r := range rs {
+		scan := mbox.NewScanner(r)
+		for scan.Scan() {
+			m := scan.Message()
+			if !keep(m) {
+				continue
+			}
+			mail++
+			if err := printer.Print(mail, m); err != nil {
+				if errors.Is(err, errLimit) {
+					break files
+				}
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
 		}
-		mail++
+		if err := scan.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, fileError(files[i], err))
+			os.Exit(2)
+		}
+	}
+	if err := printer.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func fileError(file string, err error) string {
+	var pe *mbox.ParseError
+	if errors.As(err, &pe) {
+		return fmt.Sprintf("%s:%d: %s", file, pe.Line, pe.Err)
+	}
+	return fmt.Sprintf("%s: %s", file, err)
+}
+
+func writeMessage(w io.Writer) PrintFunc {
+	return func(_ int, m mbox.Message) error {
+		return mbox.WriteMessage(w, m)
+	}
+}
+
+func printJSON(_ int, m mbox.Message) error {
+	return json.NewEncoder(os.Stdout).Encode(m.Summary())
+}
+
+const fromWidth = 32
+
+func printSummary(format string, auth bool) PrintFunc {
+	return func(mail int, m mbox.Message) error {
 		var (
 			attach = m.Files()
 			when   = m.Date().Format("2006-01-02 15:04:05")
+			from   = padLeft(truncate(formatFrom(m, format), fromWidth), fromWidth)
 			reply  = "-"
 		)
 		if m.IsReply() {
 			reply = "RE"
 		}
-		fmt.Printf("%4d | %2s | %s | %32s | %3d | %s\n", mail, reply, when, m.From(), len(attach), m.Subject())
+		if auth {
+			_, err := fmt.Printf("%4d | %2s | %s | %s | %s | %3d | %s\n", mail, reply, authStatus(m), when, from, len(attach), m.Subject())
+			return err
+		}
+		_, err := fmt.Printf("%4d | %2s | %s | %s | %3d | %s\n", mail, reply, when, from, len(attach), m.Subject())
+		return err
 	}
 }
 
-func parseArgs() ([]string, FilterFunc) {
+func authStatus(m mbox.Message) string {
+	status := func(res string) string {
+		switch res {
+		case "none", "":
+			return "-"
+		case "pass":
+			return "P"
+		case "fail":
+			return "F"
+		case "softfail":
+			return "S"
+		case "neutral":
+			return "N"
+		default:
+			return "?"
+		}
+	}
+	return status(m.SPF()) + status(m.DKIM()) + status(m.DMARC())
+}
+
+func printText(format string, auth bool) PrintFunc {
+	summary := printSummary(format, auth)
+	return func(mail int, m mbox.Message) error {
+		if mail > 1 {
+			fmt.Println()
+		}
+		if err := summary(mail, m); err != nil {
+			return err
+		}
+		_, err := fmt.Println(m.TextBody())
+		return err
+	}
+}
+
+const (
+	fromAddr = "addr"
+	fromName = "name"
+	fromFull = "full"
+)
+
+func formatFrom(m mbox.Message, format string) string {
+	as, _ := m.AddressList("from")
+	if len(as) == 0 {
+		return ""
+	}
+	a := as[0]
+	switch {
+	case format == fromName && a.Name != "":
+		return a.Name
+	case format == fromFull && a.Name != "":
+		return fmt.Sprintf("%s <%s>", a.Name, a.Addr)
+	default:
+		return a.Addr
+	}
+}
+
+func truncate(str string, n int) string {
+	if utf8.RuneCountInString(str) <= n {
+		return str
+	}
+	if n <= 0 {
+		return ""
+	}
+	rs := []rune(str)
+	return string(rs[:n-1]) + "…"
+}
+
+func padLeft(str string, n int) string {
+	if c := utf8.RuneCountInString(str); c < n {
+		str = strings.Repeat(" ", n-c) + str
+	}
+	return str
+}
+
+func parseArgs() ([]string, FilterFunc, Printer, string, limits, archive) {
 	var (
 		dtstart  Date
 		dtend    Date
+		headers  Headers
 		uniq     = flag.Bool("uniq", false, "keep only one version of e-mail")
+		uniqBody = flag.Bool("uniq-content", false, "keep only one version of e-mails with the same body")
+		uniqKeys = flag.String("uniq-headers", "", "comma separated list of headers also compared by -uniq-content (e.g. from,subject)")
 		noreply  = flag.Bool("no-reply", false, "only e-mails that are not replies")
 		attached = flag.Bool("with-attachment", false, "only e-mails that have attachments")
+		cids     = flag.Bool("check-cids", false, "only e-mails with cid references to missing parts")
+		attonly  = flag.Bool("attachment-only", false, "only e-mails without readable text body")
+		attname  = flag.String("attachment-name", "", "only e-mails with an attachment whose filename matches given pattern")
+		atttype  = flag.String("attachment-type", "", "only e-mails with an attachment of given content type")
 		subject  = flag.String("subject", "", "only e-mails with given subject")
+		grep     = flag.String("grep", "", "only e-mails whose text body matches given regexp")
+		grephdr  = flag.Bool("grep-headers", false, "also match -grep regexp against header values")
+		nocase   = flag.Bool("i", false, "ignore case when matching -grep regexp")
 		faddr    = flag.String("from", "", "only e-mails from given address")
-		taddr    = flag.String("to", "", "only e-mails to given address")
+		taddr    = flag.String("to", "", "only e-mails to given address (in To, Cc or Bcc)")
+		text     = flag.Bool("extract-text", false, "print the text body of e-mails")
+		output   = flag.String("o", "", "write e-mails to given mbox file instead of printing them")
+		asJSON   = flag.Bool("json", false, "print e-mails as JSON objects, one per line")
+		stats    = flag.Bool("stats", false, "print statistics about e-mails")
+		dupes    = flag.Bool("find-dupes", false, "print groups of e-mails identical except for their trace headers")
+		auth     = flag.Bool("auth", false, "print the SPF, DKIM and DMARC results (P: pass, F: fail, S: softfail, N: neutral, -: none)")
+		fromfmt  = flag.String("from-format", fromAddr, "format of sender in listings (addr, name, full)")
+		skip     = flag.Int("skip", 0, "ignore the first N matching e-mails")
+		head     = flag.Int("head", 0, "stop after N matching e-mails")
+		tail     = flag.Int("tail", 0, "only the last N matching e-mails")
+		since    = flag.Duration("since", 0, "only e-mails whose Date header is within given duration from now (e.g. 168h)")
+		days     = flag.Int("since-days", 0, "only e-mails whose Date header is within the last N days")
+		list     = flag.Bool("list", false, "list the entries of the given zip or tar archives")
+		entry    = flag.String("entry", "", "read e-mails from given entry of the zip or tar archives")
 	)
 	flag.Var(&dtstart, "starts", "only e-mails after given date")
 	flag.Var(&dtend, "ends", "only e-mails before given date")
+	flag.Var(&headers, "header", "only e-mails with given header matching pattern (repeatable)")
 	flag.Parse()
 
+	var re *regexp.Regexp
+	if *grep != "" {
+		expr := *grep
+		if *nocase {
+			expr = "(?i)" + expr
+		}
+		var err error
+		if re, err = regexp.Compile(expr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	switch {
+	case *since < 0 || *days < 0:
+		fmt.Fprintln(os.Stderr, "-since and -since-days should be positive")
+		os.Exit(2)
+	case *since > 0 && *days > 0:
+		fmt.Fprintln(os.Stderr, "-since and -since-days can not be used together")
+		os.Exit(2)
+	case *days > 0:
+		*since = time.Duration(*days) * 24 * time.Hour
+	}
+
 	filters := []FilterFunc{
 		withUniq(*uniq),
+		withUniqContent(*uniqBody, splitKeys(*uniqKeys)),
 		withInterval(dtstart.Time, dtend.Time),
+		withSince(time.Now(), *since),
 		withFrom(*faddr),
 		withTo(*taddr),
 		withSubject(*subject),
 		withReply(*noreply),
 		withAttachments(*attached),
+		withAttachmentName(*attname),
+		withAttachmentType(*atttype),
+		withoutBody(*attonly),
+		withMissingCIDs(*cids),
+		withGrep(re, *grephdr),
+	}
+	filters = append(filters, headers...)
+
+	if *skip < 0 || *head < 0 || *tail < 0 {
+		fmt.Fprintln(os.Stderr, "-skip, -head and -tail should be positive")
+		os.Exit(2)
 	}
 
-	return flag.Args(), keepMessage(filters...)
+	switch *fromfmt {
+	case fromAddr, fromName, fromFull:
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown from format\n", *fromfmt)
+		os.Exit(2)
+	}
+
+	var printer Printer = printSummary(*fromfmt, *auth)
+	if *text {
+		printer = printText(*fromfmt, *auth)
+	}
+	if *asJSON {
+		printer = PrintFunc(printJSON)
+	}
+	if *stats {
+		printer = &statsPrinter{}
+	}
+	if *dupes {
+		printer = &dupesPrinter{}
+	}
+	var (
+		limit = limits{skip: *skip, head: *head, tail: *tail}
+		arch  = archive{list: *list, entry: *entry}
+	)
+	return flag.Args(), keepMessage(filters...), printer, *output, limit, arch
 }
 
 func keepMessage(filters ...FilterFunc) FilterFunc {
@@ -133,11 +535,17 @@ func keepMessage(filters ...FilterFunc) FilterFunc {
 }
 
 func withHeader(k, v string) FilterFunc {
+	filter, accept := cmpStrings(v)
 	return func(m mbox.Message) bool {
 		if v == "" {
 			return m.Has(k)
 		}
-		return m.Get(k) == v
+		for _, str := range m.Header[textproto.CanonicalMIMEHeaderKey(k)] {
+			if accept(str, filter) {
+				return true
+			}
+		}
+		return false
 	}
 }
 
@@ -147,25 +555,77 @@ func withUniq(uniq bool) FilterFunc {
 	}
 	seen := make(map[string]struct{})
 	return func(m mbox.Message) bool {
-		_, ok := seen[m.Get("Message-Id")]
-		if ok {
+		id := m.MessageID()
+		if id == "" {
+			return true
+		}
+		if _, ok := seen[id]; ok {
+			return false
+		}
+		seen[id] = struct{}{}
+		return true
+	}
+}
+
+func withUniqContent(uniq bool, keys []string) FilterFunc {
+	if !uniq {
+		return func(_ mbox.Message) bool { return true }
+	}
+	seen := make(map[[sha256.Size]byte]struct{})
+	return func(m mbox.Message) bool {
+		sum := contentHash(m, keys)
+		if _, ok := seen[sum]; ok {
 			return false
 		}
-		seen[m.Get("Message-Id")] = struct{}{}
+		seen[sum] = struct{}{}
 		return true
 	}
 }
 
+func contentHash(m mbox.Message, keys []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, k := range keys {
+		for _, str := range m.Header[textproto.CanonicalMIMEHeaderKey(k)] {
+			io.WriteString(h, str)
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{0})
+	}
+	for _, p := range m.Parts {
+		body, err := p.DecodedBody()
+		if err != nil {
+			body = p.Bytes()
+		}
+		h.Write(body)
+		h.Write([]byte{0})
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func splitKeys(str string) []string {
+	var keys []string
+	for _, k := range strings.Split(str, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
 func withFrom(from string) FilterFunc {
 	filter, accept := cmpStrings(from)
+	filter = mbox.NormalizeAddress(filter)
 	return func(m mbox.Message) bool {
-		return accept(m.From(), filter)
+		return accept(mbox.NormalizeAddress(m.From()), filter)
 	}
 }
 
 func withTo(to string) FilterFunc {
+	to = mbox.NormalizeAddress(to)
 	return func(m mbox.Message) bool {
-		list := m.To()
+		list := m.Recipients()
 		sort.Strings(list)
 		i := sort.SearchStrings(list, to)
 		return to == "" || (i < len(list) && list[i] == to)
@@ -175,7 +635,7 @@ func withTo(to string) FilterFunc {
 func withSubject(subj string) FilterFunc {
 	filter, accept := cmpStrings(subj)
 	return func(m mbox.Message) bool {
-		return accept(m.Subject(), filter)
+		return accept(m.DecodedSubject(), filter)
 	}
 }
 
@@ -194,6 +654,70 @@ func withAttachments(attached bool) FilterFunc {
 	}
 }
 
+func withAttachmentName(name string) FilterFunc {
+	filter, accept := cmpStrings(name)
+	return func(m mbox.Message) bool {
+		if name == "" {
+			return true
+		}
+		for _, p := range m.Attachments() {
+			if accept(p.Filename(), filter) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func withAttachmentType(mt string) FilterFunc {
+	filter, accept := cmpStrings(strings.ToLower(mt))
+	return func(m mbox.Message) bool {
+		if mt == "" {
+			return true
+		}
+		for _, t := range m.AttachmentTypes() {
+			if accept(t, filter) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func withGrep(re *regexp.Regexp, headers bool) FilterFunc {
+	return func(m mbox.Message) bool {
+		if re == nil {
+			return true
+		}
+		if re.MatchString(m.TextBody()) {
+			return true
+		}
+		if !headers {
+			return false
+		}
+		for _, vs := range m.Summary().Headers {
+			for _, v := range vs {
+				if re.MatchString(v) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+func withMissingCIDs(check bool) FilterFunc {
+	return func(m mbox.Message) bool {
+		return !check || len(m.MissingCIDs()) > 0
+	}
+}
+
+func withoutBody(attonly bool) FilterFunc {
+	return func(m mbox.Message) bool {
+		return !attonly || !m.HasReadableBody()
+	}
+}
+
 func withInterval(fd, td time.Time) FilterFunc {
 	return func(m mbox.Message) bool {
 		if fd.IsZero() && td.IsZero() {
@@ -203,8 +727,17 @@ func withInterval(fd, td time.Time) FilterFunc {
 		if !fd.IsZero() && fd.After(when) {
 			return false
 		}
-		return !td.IsZero() && td.After(when)
+		return td.IsZero() || td.After(when)
+	}
+}
+
+// withSince keeps the e-mails whose Date header, not the date of their From
+// line, is more recent than now minus d.
+func withSince(now time.Time, d time.Duration) FilterFunc {
+	if d <= 0 {
+		return withInterval(time.Time{}, time.Time{})
 	}
+	return withInterval(now.Add(-d), time.Time{})
 }
 
 func cmpStrings(str string) (string, func(string, string) bool) {
@@ -213,20 +746,20 @@ func cmpStrings(str string) (string, func(string, string) bool) {
 	}
 	var (
 		not bool
-		cmp func(string, string) bool
+		cmp = func(str1, str2 string) bool { return str1 == str2 }
 	)
 	if str[0] == '!' {
 		not, str = true, str[1:]
 	}
-	switch str[0] {
-	case '^':
-		cmp, str = strings.HasPrefix, str[1:]
-	case '$':
-		cmp, str = strings.HasSuffix, str[1:]
-	case '~':
-		cmp, str = strings.Contains, str[1:]
-	default:
-		cmp = func(str1, str2 string) bool { return str1 == str2 }
+	if len(str) > 0 {
+		switch str[0] {
+		case '^':
+			cmp, str = strings.HasPrefix, str[1:]
+		case '$':
+			cmp, str = strings.HasSuffix, str[1:]
+		case '~':
+			cmp, str = strings.Contains, str[1:]
+		}
 	}
 	if not {
 		return str, func(str1, str2 string) bool { return !cmp(str1, str2) }
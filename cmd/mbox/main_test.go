@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/midbel/mbox"
+)
+
+func TestWithTo(t *testing.T) {
+	m := readMessage(t, "recipients.txt")
+	data := []struct {
+		Addr string
+		Want bool
+	}{
+		{Addr: "", Want: true},
+		{Addr: "jerome@foobar.org", Want: true},
+		{Addr: "alice@foobar.org", Want: true},
+		{Addr: "bob@foobar.org", Want: true},
+		{Addr: "Alice@FooBar.org", Want: true},
+		{Addr: "<RUSTINE@foobar.ORG>", Want: true},
+		{Addr: "midbel@foobar.org", Want: false},
+	}
+	for _, d := range data {
+		if got := withTo(d.Addr)(m); got != d.Want {
+			t.Errorf("%s: filter mismatched! want %t, got %t", d.Addr, d.Want, got)
+		}
+	}
+}
+
+func TestWithFrom(t *testing.T) {
+	m := readMessage(t, "recipients.txt")
+	m.Set("From", "Boss <Boss@Corp.com>")
+	data := []struct {
+		Addr string
+		Want bool
+	}{
+		{Addr: "", Want: true},
+		{Addr: "boss@corp.com", Want: true},
+		{Addr: "BOSS@CORP.COM", Want: true},
+		{Addr: "<Boss@Corp.com>", Want: true},
+		{Addr: "$@CORP.com", Want: true},
+		{Addr: "!^boss", Want: false},
+		{Addr: "midbel@foobar.org", Want: false},
+	}
+	for _, d := range data {
+		if got := withFrom(d.Addr)(m); got != d.Want {
+			t.Errorf("%s: filter mismatched! want %t, got %t", d.Addr, d.Want, got)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	m := readMessage(t, "simple.txt")
+	data := []struct {
+		Headers []string
+		Want    bool
+	}{
+		{Headers: []string{"Subject=mbox test"}, Want: true},
+		{Headers: []string{"subject=~box"}, Want: true},
+		{Headers: []string{"Subject=!^mbox"}, Want: false},
+		{Headers: []string{"Message-ID"}, Want: true},
+		{Headers: []string{"X-Spam-Flag"}, Want: false},
+		{Headers: []string{"X-Spam-Flag=YES"}, Want: false},
+		{Headers: []string{"Message-ID", "Subject=$test"}, Want: true},
+		{Headers: []string{"Message-ID", "X-Spam-Flag"}, Want: false},
+		{Headers: []string{"Subject=!"}, Want: true},
+		{Headers: []string{"X-Spam-Flag=!"}, Want: false},
+	}
+	for _, d := range data {
+		var hs Headers
+		for _, h := range d.Headers {
+			if err := hs.Set(h); err != nil {
+				t.Fatalf("%s: unexpected error: %s", h, err)
+			}
+		}
+		if got := keepMessage(hs...)(m); got != d.Want {
+			t.Errorf("%v: filter mismatched! want %t, got %t", d.Headers, d.Want, got)
+		}
+	}
+	var hs Headers
+	if err := hs.Set("=value"); err == nil {
+		t.Errorf("expected error for missing header name")
+	}
+}
+
+func TestAuthStatus(t *testing.T) {
+	data := []struct {
+		File string
+		Want string
+	}{
+		{File: "auth.txt", Want: "PFP"},
+		{File: "simple.txt", Want: "---"},
+	}
+	for _, d := range data {
+		m := readMessage(t, d.File)
+		if got := authStatus(m); got != d.Want {
+			t.Errorf("%s: status mismatched! want %s, got %s", d.File, d.Want, got)
+		}
+	}
+}
+
+func TestWithSince(t *testing.T) {
+	var (
+		m    = readMessage(t, "recipients.txt")
+		now  = time.Date(2020, 1, 29, 12, 0, 0, 0, time.UTC)
+		data = []struct {
+			Since time.Duration
+			Want  bool
+		}{
+			{Since: 0, Want: true},
+			{Since: 168 * time.Hour, Want: false},
+			{Since: 8 * 24 * time.Hour, Want: true},
+			{Since: time.Hour, Want: false},
+		}
+	)
+	for _, d := range data {
+		if got := withSince(now, d.Since)(m); got != d.Want {
+			t.Errorf("%s: filter mismatched! want %t, got %t", d.Since, d.Want, got)
+		}
+	}
+}
+
+func TestWithInterval(t *testing.T) {
+	var (
+		m    = readMessage(t, "recipients.txt")
+		data = []struct {
+			Starts time.Time
+			Ends   time.Time
+			Want   bool
+		}{
+			{Want: true},
+			{Starts: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Want: true},
+			{Starts: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), Want: false},
+			{Ends: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), Want: true},
+			{Ends: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Want: false},
+			{
+				Starts: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				Ends:   time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+				Want:   true,
+			},
+		}
+	)
+	for _, d := range data {
+		if got := withInterval(d.Starts, d.Ends)(m); got != d.Want {
+			t.Errorf("%s - %s: filter mismatched! want %t, got %t", d.Starts, d.Ends, d.Want, got)
+		}
+	}
+}
+
+func TestWithAttachment(t *testing.T) {
+	r, err := os.Open(filepath.Join("..", "..", "testdata", "inline.txt"))
+	if err != nil {
+		t.Fatalf("fail to open inline.txt: %s", err)
+	}
+	defer r.Close()
+
+	var (
+		list []mbox.Message
+		scan = mbox.NewScanner(r)
+	)
+	for scan.Scan() {
+		list = append(list, scan.Message())
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse inline.txt: %s", err)
+	}
+	data := []struct {
+		Name string
+		Type string
+		Want []bool
+	}{
+		{Want: []bool{true, true, true}},
+		{Name: "report.pdf", Want: []bool{false, true, false}},
+		{Name: "$.pdf", Want: []bool{false, true, false}},
+		{Name: "~.png", Want: []bool{false, false, false}},
+		{Name: "^notes", Want: []bool{false, false, true}},
+		{Name: "!", Want: []bool{false, true, true}},
+		{Name: "!^", Want: []bool{false, false, false}},
+		{Type: "application/pdf", Want: []bool{false, true, false}},
+		{Type: "Application/PDF", Want: []bool{false, true, false}},
+		{Type: "^image/", Want: []bool{false, false, false}},
+		{Type: "^text/", Want: []bool{false, false, true}},
+		{Name: "$.pdf", Type: "text/plain", Want: []bool{false, false, false}},
+	}
+	for _, d := range data {
+		keep := keepMessage(withAttachmentName(d.Name), withAttachmentType(d.Type))
+		for i, m := range list {
+			if got := keep(m); got != d.Want[i] {
+				t.Errorf("%s/%s (%s): filter mismatched! want %t, got %t", d.Name, d.Type, m.Subject(), d.Want[i], got)
+			}
+		}
+	}
+}
+
+func TestWithSubject(t *testing.T) {
+	m := readMessage(t, "encoded-subject.txt")
+	data := []struct {
+		Subject string
+		Want    bool
+	}{
+		{Subject: "", Want: true},
+		{Subject: "~invoice", Want: true},
+		{Subject: "Your invoice n° 42 €", Want: true},
+		{Subject: "$42 €", Want: true},
+		{Subject: "~UTF-8", Want: false},
+		{Subject: "!^Your", Want: false},
+	}
+	for _, d := range data {
+		if got := withSubject(d.Subject)(m); got != d.Want {
+			t.Errorf("%s: filter mismatched! want %t, got %t", d.Subject, d.Want, got)
+		}
+	}
+}
+
+func TestWithGrep(t *testing.T) {
+	m := readMessage(t, "encoded.txt")
+	data := []struct {
+		Expr    string
+		Headers bool
+		Want    bool
+	}{
+		{Expr: `good luck`, Want: true},
+		{Expr: `(?i)GOOD\s+LUCK`, Want: true},
+		{Expr: `GOOD LUCK`, Want: false},
+		{Expr: `café`, Want: false},
+		{Expr: `café`, Headers: true, Want: true},
+		{Expr: `^rustine`, Headers: true, Want: true},
+		{Expr: `nowhere`, Headers: true, Want: false},
+	}
+	for _, d := range data {
+		re := regexp.MustCompile(d.Expr)
+		if got := withGrep(re, d.Headers)(m); got != d.Want {
+			t.Errorf("%s: filter mismatched! want %t, got %t", d.Expr, d.Want, got)
+		}
+	}
+	if !withGrep(nil, false)(m) {
+		t.Errorf("message should be kept without regexp")
+	}
+}
+
+func TestWithUniq(t *testing.T) {
+	ms := []mbox.Message{
+		parseMessage(t, "<1@foobar.org>", "hello world"),
+		parseMessage(t, "<1@foobar.org>", "hello world"),
+		parseMessage(t, "", "hello world"),
+		parseMessage(t, "", "hello world"),
+		parseMessage(t, "<2@foobar.org>", "hello world"),
+	}
+	want := []bool{true, false, true, true, true}
+
+	keep := withUniq(true)
+	for i, m := range ms {
+		if got := keep(m); got != want[i] {
+			t.Errorf("%d: filter mismatched! want %t, got %t", i+1, want[i], got)
+		}
+	}
+}
+
+func TestWithUniqContent(t *testing.T) {
+	ms := []mbox.Message{
+		parseMessage(t, "<1@foobar.org>", "hello world"),
+		parseMessage(t, "<2@foobar.org>", "hello world"),
+		parseMessage(t, "", "hello world"),
+		parseMessage(t, "<3@foobar.org>", "hello world!"),
+		parseMessage(t, "", "hello world!"),
+	}
+	want := []bool{true, false, false, true, false}
+
+	keep := withUniqContent(true, nil)
+	for i, m := range ms {
+		if got := keep(m); got != want[i] {
+			t.Errorf("%d: filter mismatched! want %t, got %t", i+1, want[i], got)
+		}
+	}
+
+	other := parseMessage(t, "<4@foobar.org>", "hello world")
+	other.Set("Subject", "another subject")
+	data := []struct {
+		Keys string
+		Want bool
+	}{
+		{Keys: "", Want: false},
+		{Keys: "from", Want: false},
+		{Keys: "from, Subject", Want: true},
+	}
+	for _, d := range data {
+		keep := withUniqContent(true, splitKeys(d.Keys))
+		keep(ms[0])
+		if got := keep(other); got != d.Want {
+			t.Errorf("%s: filter mismatched! want %t, got %t", d.Keys, d.Want, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	data := []struct {
+		Input string
+		Len   int
+		Want  string
+	}{
+		{Input: "midbel@foobar.org", Len: 32, Want: "midbel@foobar.org"},
+		{Input: "midbel@foobar.org", Len: 6, Want: "midbe…"},
+		{Input: "Jérôme Durand-Lefèvre", Len: 5, Want: "Jérô…"},
+		{Input: "日本語のメールアドレス", Len: 4, Want: "日本語…"},
+		{Input: "日本語", Len: 3, Want: "日本語"},
+		{Input: "日本語", Len: 0, Want: ""},
+	}
+	for _, d := range data {
+		got := truncate(d.Input, d.Len)
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: invalid utf-8 after truncation: %q", d.Input, got)
+		}
+		if got != d.Want {
+			t.Errorf("%s: truncation mismatched! want %s, got %s", d.Input, d.Want, got)
+		}
+	}
+}
+
+func TestFormatFrom(t *testing.T) {
+	m := parseMessage(t, "", "hello world")
+	data := []struct {
+		Format string
+		Want   string
+	}{
+		{Format: fromAddr, Want: "midbel@foobar.org"},
+		{Format: fromName, Want: "midbel"},
+		{Format: fromFull, Want: "midbel <midbel@foobar.org>"},
+	}
+	for _, d := range data {
+		if got := formatFrom(m, d.Format); got != d.Want {
+			t.Errorf("%s: sender mismatched! want %s, got %s", d.Format, d.Want, got)
+		}
+	}
+}
+
+func parseMessage(t *testing.T, id, body string) mbox.Message {
+	t.Helper()
+	var str strings.Builder
+	str.WriteString("From midbel@foobar.org Wed Jan 22 11:15:00 2020\n")
+	str.WriteString("From: midbel <midbel@foobar.org>\n")
+	str.WriteString("Subject: mbox test\n")
+	if id != "" {
+		str.WriteString("Message-ID: " + id + "\n")
+	}
+	str.WriteString("\n" + body + "\n")
+
+	m, err := mbox.ReadMessage(bufio.NewReader(strings.NewReader(str.String())))
+	if err != nil {
+		t.Fatalf("fail to parse message: %s", err)
+	}
+	return m
+}
+
+func readMessage(t *testing.T, file string) mbox.Message {
+	t.Helper()
+	r, err := os.Open(filepath.Join("..", "..", "testdata", file))
+	if err != nil {
+		t.Fatalf("fail to open %s: %s", file, err)
+	}
+	defer r.Close()
+
+	m, err := mbox.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		t.Fatalf("fail to parse %s: %s", file, err)
+	}
+	return m
+}
+
+func TestLimits(t *testing.T) {
+	data := []struct {
+		Limit limits
+		Want  []int
+		Stop  int
+	}{
+		{Limit: limits{}, Want: []int{1, 2, 3, 4, 5, 6}},
+		{Limit: limits{skip: 2}, Want: []int{3, 4, 5, 6}},
+		{Limit: limits{head: 2}, Want: []int{1, 2}, Stop: 2},
+		{Limit: limits{skip: 1, head: 2}, Want: []int{2, 3}, Stop: 3},
+		{Limit: limits{tail: 2}, Want: []int{5, 6}},
+		{Limit: limits{skip: 1, head: 4, tail: 2}, Want: []int{4, 5}, Stop: 5},
+		{Limit: limits{head: 10}, Want: []int{1, 2, 3, 4, 5, 6}},
+	}
+	m := parseMessage(t, "<1@foobar.org>", "hello world")
+	for _, d := range data {
+		var (
+			got     []int
+			stop    int
+			printer = d.Limit.wrap(PrintFunc(func(mail int, _ mbox.Message) error {
+				got = append(got, mail)
+				return nil
+			}))
+		)
+		for i := 1; i <= 6; i++ {
+			if err := printer.Print(i, m); err != nil {
+				if !errors.Is(err, errLimit) {
+					t.Fatalf("%+v: unexpected error: %s", d.Limit, err)
+				}
+				stop = i
+				break
+			}
+		}
+		if err := printer.Flush(); err != nil {
+			t.Fatalf("%+v: unexpected error: %s", d.Limit, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(d.Want) {
+			t.Errorf("%+v: messages mismatched! want %v, got %v", d.Limit, d.Want, got)
+		}
+		if stop != d.Stop {
+			t.Errorf("%+v: should stop after %d messages, got %d", d.Limit, d.Stop, stop)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/midbel/mbox"
+)
+
+func main() {
+	pattern := flag.String("p", "{{.Date}}-{{.Index}}.eml", "template used to name the output files")
+	quiet := flag.Bool("q", false, "do not print the files written")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = append(files, "-")
+	}
+	for _, file := range files {
+		if err := split(file, *pattern, *quiet); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func split(file, pattern string, quiet bool) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	list, err := mbox.Split(r, pattern)
+	if !quiet {
+		for _, f := range list {
+			fmt.Println(f)
+		}
+	}
+	return err
+}
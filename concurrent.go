@@ -0,0 +1,121 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// ReadAllConcurrent splits the messages of r sequentially, parses them from a
+// pool of workers goroutines and calls fn for each of them, from the calling
+// goroutine and in the order of the messages in r. fn receives the index of
+// the message in r. A value of workers lower or equal to zero uses GOMAXPROCS
+// workers.
+//
+// Messages are split on their From lines as SplitReader does: their
+// Content-Length is ignored.
+//
+// ReadAllConcurrent stops at the first error, either returned by fn or met
+// when parsing a message, and returns it.
+func ReadAllConcurrent(r io.Reader, workers int, fn func(int, Message) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	type result struct {
+		msg Message
+		err error
+	}
+	type job struct {
+		chunk rawChunk
+		done  chan result
+	}
+	var (
+		jobs    = make(chan job, workers)
+		pending = make(chan chan result, workers)
+		stop    = make(chan struct{})
+		scanErr error
+	)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				m, err := j.chunk.parse()
+				j.done <- result{msg: m, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+
+		scan := SplitReader(r)
+		for scan.Scan() {
+			chunk := rawChunk{
+				fromLine: scan.FromLine(),
+				offset:   scan.r.fromOffset,
+				line:     scan.r.line,
+				eol:      "\n",
+			}
+			if int(scan.r.offset-chunk.offset) > len(chunk.fromLine)+1 {
+				chunk.eol = "\r\n"
+			}
+			var err error
+			if chunk.body, err = io.ReadAll(scan.Reader()); err != nil {
+				scanErr = err
+				return
+			}
+			done := make(chan result, 1)
+			select {
+			case pending <- done:
+			case <-stop:
+				return
+			}
+			jobs <- job{chunk: chunk, done: done}
+		}
+		scanErr = scan.Err()
+	}()
+
+	var (
+		index int
+		err   error
+	)
+	for done := range pending {
+		res := <-done
+		if err == nil {
+			err = res.err
+			if err == nil {
+				err = fn(index, res.msg)
+			}
+			if err != nil {
+				close(stop)
+			}
+		}
+		index++
+	}
+	if err != nil {
+		return err
+	}
+	return scanErr
+}
+
+// rawChunk is a message split from a mailbox, not yet parsed.
+type rawChunk struct {
+	fromLine string
+	eol      string
+	body     []byte
+	offset   int64
+	line     int
+}
+
+func (c rawChunk) parse() (Message, error) {
+	rs := io.MultiReader(strings.NewReader(c.fromLine+c.eol), bytes.NewReader(c.body))
+	m, err := ReadMessage(bufio.NewReader(rs))
+	var pe *ParseError
+	if errors.As(err, &pe) {
+		pe.Offset += c.offset
+		pe.Line += c.line - 1
+	}
+	return m, err
+}
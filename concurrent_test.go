@@ -0,0 +1,118 @@
+package mbox
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestReadAllConcurrent(t *testing.T) {
+	data := concurrentMailbox(t, 100)
+
+	var seen []int
+	err := ReadAllConcurrent(bytes.NewReader(data), 4, func(i int, m Message) error {
+		seen = append(seen, i)
+		if m.Subject() != defaultSubject {
+			t.Errorf("%d: wrong subject! want %s, got %s", i, defaultSubject, m.Subject())
+		}
+		want := 1
+		if i%2 == 1 {
+			want = 3
+		}
+		if len(m.Parts) != want {
+			t.Errorf("%d: wrong number of parts! want %d, got %d", i, want, len(m.Parts))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(seen) != 100 {
+		t.Fatalf("wrong number of messages! want %d, got %d", 100, len(seen))
+	}
+	for i := range seen {
+		if seen[i] != i {
+			t.Fatalf("wrong order! want %d, got %d", i, seen[i])
+		}
+	}
+
+	errFail := errors.New("fail")
+	seen = seen[:0]
+	err = ReadAllConcurrent(bytes.NewReader(data), 4, func(i int, m Message) error {
+		seen = append(seen, i)
+		if i == 10 || i == 20 {
+			return errFail
+		}
+		return nil
+	})
+	if !errors.Is(err, errFail) {
+		t.Errorf("unexpected error! want %s, got %v", errFail, err)
+	}
+	if len(seen) != 11 {
+		t.Errorf("fn called after an error! want %d calls, got %d", 11, len(seen))
+	}
+}
+
+func TestReadAllConcurrentParseError(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "badheader.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	data := append(concurrentMailbox(t, 3), bs...)
+
+	scan := NewScanner(bytes.NewReader(data))
+	for scan.Scan() {
+	}
+	want := scan.Err()
+	if want == nil {
+		t.Fatalf("scanner should fail on badheader.txt")
+	}
+	err = ReadAllConcurrent(bytes.NewReader(data), 4, func(int, Message) error {
+		return nil
+	})
+	if err == nil || err.Error() != want.Error() {
+		t.Errorf("wrong error! want %s, got %v", want, err)
+	}
+}
+
+func BenchmarkReadAllConcurrent(b *testing.B) {
+	var (
+		data = concurrentMailbox(b, 500)
+		re   = regexp.MustCompile(`(?i)good\s+luck`)
+	)
+	work := func(_ int, m Message) error {
+		re.MatchString(m.TextBody())
+		return nil
+	}
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ReadAllConcurrent(bytes.NewReader(data), 1, work)
+		}
+	})
+	b.Run("concurrent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ReadAllConcurrent(bytes.NewReader(data), 0, work)
+		}
+	})
+}
+
+func concurrentMailbox(t testing.TB, n int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		file := "simple.txt"
+		if i%2 == 1 {
+			file = "mixedalt.txt"
+		}
+		bs, err := os.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", file, err)
+		}
+		buf.Write(bs)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
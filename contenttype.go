@@ -0,0 +1,166 @@
+package mbox
+
+import (
+	"strings"
+
+	"github.com/midbel/mime"
+)
+
+// ContentTypeParser parses the value of a Content-Type header into its media
+// type (type/subtype) and its parameters.
+type ContentTypeParser interface {
+	ParseContentType(str string) (string, map[string]string, error)
+}
+
+// ContentTypeParserFunc adapts a function, like mime.ParseMediaType of the
+// standard library, to the ContentTypeParser interface.
+type ContentTypeParserFunc func(string) (string, map[string]string, error)
+
+func (f ContentTypeParserFunc) ParseContentType(str string) (string, map[string]string, error) {
+	return f(str)
+}
+
+type defaultParser struct{}
+
+func (defaultParser) ParseContentType(str string) (string, map[string]string, error) {
+	mt, err := mime.Parse(str)
+	if err != nil {
+		return "", nil, err
+	}
+	return mt.MainType + "/" + mt.SubType, mt.Params, nil
+}
+
+type mediaType struct {
+	MainType string
+	SubType  string
+	Params   map[string]string
+}
+
+func parseContentType(parser ContentTypeParser, str string) (mediaType, error) {
+	if parser == nil {
+		parser = defaultParser{}
+	}
+	typ, params, err := parser.ParseContentType(str)
+	if err != nil {
+		if fixed, ok := completeSubType(str); ok {
+			typ, params, err = parser.ParseContentType(fixed)
+		}
+	}
+	if err != nil {
+		// unquoted boundaries with special characters (boundary=----=_Part_1)
+		// are commonly found but rejected by strict parsers.
+		if rawBoundary(str) == "" {
+			return mediaType{}, err
+		}
+		typ, _, _ = strings.Cut(str, ";")
+		typ, params = strings.ToLower(strings.TrimSpace(typ)), nil
+	}
+	if params == nil {
+		params = make(map[string]string)
+	}
+	main, sub, _ := strings.Cut(typ, "/")
+	if main != "" && sub == "" {
+		main, sub = defaultSubType(main)
+	}
+	if strings.EqualFold(main, multiPart) {
+		if b := rawBoundary(str); b != "" {
+			params[multiBound] = b
+		}
+	}
+	return mediaType{MainType: main, SubType: sub, Params: params}, nil
+}
+
+// defaultSubType completes a media type given without subtype, as in
+// "Content-Type: multipart", with the subtype that RFC 2046 uses for the
+// unrecognized subtypes of main.
+func defaultSubType(main string) (string, string) {
+	switch main = strings.ToLower(main); main {
+	case "text":
+		return main, "plain"
+	case multiPart:
+		return main, multiMixed
+	default:
+		return "application", "octet-stream"
+	}
+}
+
+// completeSubType adds the default subtype to the media type of str when it is
+// missing, so that strict parsers accept it.
+func completeSubType(str string) (string, bool) {
+	typ, rest, _ := strings.Cut(str, ";")
+	typ = strings.TrimSpace(typ)
+	if typ == "" || strings.ContainsAny(typ, "/ \t") {
+		return "", false
+	}
+	main, sub := defaultSubType(typ)
+	if rest != "" {
+		rest = ";" + rest
+	}
+	return main + "/" + sub + rest, true
+}
+
+func (mt mediaType) hasBoundary() bool {
+	return mt.Params[multiBound] != ""
+}
+
+// rawBoundary extracts the boundary parameter from the value of a Content-Type
+// header, without its quotes and the trailing whitespace left by folding.
+func rawBoundary(str string) string {
+	const param = "boundary"
+	lower := asciiLower(str)
+	for i := 0; i < len(str); {
+		ix := strings.Index(lower[i:], param)
+		if ix < 0 {
+			break
+		}
+		ix += i
+		i = ix + len(param)
+		if ix > 0 && !strings.ContainsRune("; \t", rune(str[ix-1])) {
+			continue
+		}
+		rest := strings.TrimLeft(str[i:], " \t")
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t")
+		if strings.HasPrefix(rest, `"`) {
+			rest = rest[1:]
+			if end := strings.IndexByte(rest, '"'); end >= 0 {
+				rest = rest[:end]
+			}
+		} else if end := strings.IndexByte(rest, ';'); end >= 0 {
+			rest = rest[:end]
+		}
+		return strings.TrimRight(rest, " \t")
+	}
+	return ""
+}
+
+func (m Message) mediaType() (mediaType, error) {
+	return parseContentType(m.parser, m.contentType())
+}
+
+func (p Part) mediaType() (mediaType, error) {
+	return parseContentType(p.parser, p.contentType())
+}
+
+// contentType returns the first Content-Type of the header. The duplicated
+// Content-Type headers are ignored.
+func (h Header) contentType() string {
+	if vs := h.Values(hdrContentType); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// asciiLower lowercases the ASCII letters of str only, so that the offsets in
+// the result match the ones of str even when it is not valid UTF-8.
+func asciiLower(str string) string {
+	bs := []byte(str)
+	for i, b := range bs {
+		if 'A' <= b && b <= 'Z' {
+			bs[i] = b + 'a' - 'A'
+		}
+	}
+	return string(bs)
+}
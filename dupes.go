@@ -0,0 +1,80 @@
+package mbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/textproto"
+	"sort"
+)
+
+var traceHeaders = map[string]struct{}{
+	"Received":               {},
+	"X-Received":             {},
+	"Return-Path":            {},
+	"Delivered-To":           {},
+	"X-Original-To":          {},
+	"Authentication-Results": {},
+	"Received-Spf":           {},
+}
+
+// Fingerprint returns a digest of the headers and the bodies of the message.
+// Trace headers added by each relay (Received, Return-Path,...) and the From_
+// line are left out so that copies of the same mail captured at different hops
+// have the same fingerprint.
+func (m Message) Fingerprint() string {
+	h := sha256.New()
+	hashHeader(h, m.Header)
+	for _, p := range m.Parts {
+		hashHeader(h, p.Header)
+		h.Write(p.Body)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashHeader(w io.Writer, hdr Header) {
+	keys := make([]string, 0, len(hdr))
+	for k := range hdr {
+		if _, ok := traceHeaders[textproto.CanonicalMIMEHeaderKey(k)]; ok {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range hdr[k] {
+			io.WriteString(w, k)
+			io.WriteString(w, ": ")
+			io.WriteString(w, v)
+			w.Write([]byte{0})
+		}
+	}
+	w.Write([]byte{0})
+}
+
+// FindDuplicates groups the indices of messages having the same Fingerprint.
+// Only groups of at least two messages are returned, ordered by their first
+// index.
+func FindDuplicates(ms []Message) [][]int {
+	var (
+		groups = make(map[string]int)
+		list   [][]int
+	)
+	for i, m := range ms {
+		fp := m.Fingerprint()
+		if j, ok := groups[fp]; ok {
+			list[j] = append(list[j], i)
+			continue
+		}
+		groups[fp] = len(list)
+		list = append(list, []int{i})
+	}
+	var dupes [][]int
+	for _, is := range list {
+		if len(is) > 1 {
+			dupes = append(dupes, is)
+		}
+	}
+	return dupes
+}
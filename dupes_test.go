@@ -0,0 +1,37 @@
+package mbox
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "dupes.txt"))
+	if err != nil {
+		t.Fatalf("fail to open mbox: %s", err)
+	}
+	defer r.Close()
+
+	var (
+		scan = NewScanner(r)
+		ms   []Message
+	)
+	for scan.Scan() {
+		ms = append(ms, scan.Message())
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(ms) != 3 {
+		t.Fatalf("wrong number of messages! want %d, got %d", 3, len(ms))
+	}
+	want := [][]int{{0, 1}}
+	if got := FindDuplicates(ms); !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicates mismatched! want %v, got %v", want, got)
+	}
+	if ms[0].Fingerprint() == ms[2].Fingerprint() {
+		t.Errorf("different messages have the same fingerprint")
+	}
+}
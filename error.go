@@ -0,0 +1,23 @@
+package mbox
+
+import (
+	"fmt"
+)
+
+// ParseError reports the position of the line being read when parsing a
+// message failed. Offset is the byte offset of the start of the line and Line
+// its 1-based number. Both are counted from the first byte read by
+// ReadMessage or, when using a Scanner, from the start of its input.
+type ParseError struct {
+	Offset int64
+	Line   int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d (offset %d): %s", e.Line, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
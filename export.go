@@ -0,0 +1,63 @@
+package mbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+type ExportOptions struct {
+	Fields []string
+	Body   bool
+}
+
+func WriteNDJSON(w io.Writer, r io.Reader, opts ExportOptions) (count int, err error) {
+	var (
+		ws   = bufio.NewWriter(w)
+		enc  = json.NewEncoder(ws)
+		scan = NewScanner(r)
+	)
+	defer func() {
+		if e := ws.Flush(); err == nil {
+			err = e
+		}
+	}()
+	for scan.Scan() {
+		m := scan.Message()
+		if err := enc.Encode(opts.export(m)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, scan.Err()
+}
+
+func (o ExportOptions) export(m Message) map[string]interface{} {
+	s := m.Summary()
+	doc := map[string]interface{}{
+		"message-id":  s.MessageID,
+		"from":        s.From,
+		"to":          s.To,
+		"subject":     s.Subject,
+		"date":        s.Date,
+		"headers":     s.Headers,
+		"attachments": s.Attachments,
+		"parts":       s.Parts,
+	}
+	if o.Body {
+		doc["body"] = m.TextBody()
+	}
+	if len(o.Fields) == 0 {
+		return doc
+	}
+	sub := make(map[string]interface{})
+	for _, f := range o.Fields {
+		if v, ok := doc[f]; ok {
+			sub[f] = v
+		}
+	}
+	if o.Body {
+		sub["body"] = doc["body"]
+	}
+	return sub
+}
@@ -0,0 +1,86 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteNDJSON(t *testing.T) {
+	var (
+		files = []string{"simple.txt", "mixed.txt", "encoded.txt", "reply.txt"}
+		buf   bytes.Buffer
+	)
+	for _, f := range files {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		buf.Write(bs)
+		buf.WriteString("\n")
+	}
+	var (
+		out  bytes.Buffer
+		opts = ExportOptions{
+			Fields: []string{"message-id", "subject"},
+			Body:   true,
+		}
+	)
+	n, err := WriteNDJSON(&out, &buf, opts)
+	if err != nil {
+		t.Fatalf("fail to export mbox: %s", err)
+	}
+	if n != len(files) {
+		t.Fatalf("wrong number of messages! want %d, got %d", len(files), n)
+	}
+	scan := bufio.NewScanner(&out)
+	for i := 0; scan.Scan(); i++ {
+		if i >= len(files) {
+			t.Fatalf("too many lines written")
+		}
+		var doc map[string]string
+		if err := json.Unmarshal(scan.Bytes(), &doc); err != nil {
+			t.Fatalf("%s: fail to decode line: %s", files[i], err)
+		}
+		if len(doc) != 3 {
+			t.Errorf("%s: unexpected fields: %v", files[i], doc)
+		}
+		m, err := openMessage(files[i])
+		if err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", files[i], err)
+		}
+		s := m.Summary()
+		if doc["message-id"] != s.MessageID || doc["subject"] != s.Subject {
+			t.Errorf("%s: exported message mismatched: %v", files[i], doc)
+		}
+		if doc["body"] != m.TextBody() {
+			t.Errorf("%s: wrong body! want %q, got %q", files[i], m.TextBody(), doc["body"])
+		}
+	}
+}
+
+func TestWriteNDJSONFlushOnError(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "simple.txt"))
+	if err != nil {
+		t.Fatalf("fail to read simple.txt: %s", err)
+	}
+	var buf bytes.Buffer
+	buf.Write(bs)
+	buf.WriteString("\nFrom midbel@foobar.org Wed Jan 22 11:15:00 2020\nContent-Length: abc\n\nbody\n")
+
+	var out bytes.Buffer
+	n, err := WriteNDJSON(&out, &buf, ExportOptions{})
+	if !errors.Is(err, ErrInvalidLength) {
+		t.Fatalf("unexpected error! want %s, got %v", ErrInvalidLength, err)
+	}
+	if n != 1 {
+		t.Fatalf("wrong number of messages! want %d, got %d", 1, n)
+	}
+	if lines := bytes.Count(out.Bytes(), []byte("\n")); lines != n {
+		t.Errorf("exported messages not flushed! want %d lines, got %d", n, lines)
+	}
+}
@@ -0,0 +1,130 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzReadMessage reads arbitrary input and calls the methods of the resulting
+// messages and parts to detect the panics. The corpus is seeded with the
+// mailboxes of testdata.
+func FuzzReadMessage(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		f.Fatalf("fail to list testdata: %s", err)
+	}
+	for _, file := range files {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatalf("fail to read %s: %s", file, err)
+		}
+		f.Add(bs)
+	}
+	for _, n := range []string{"9223372036854775807", "99999999999999999999", "-1", "4096"} {
+		f.Add([]byte("From 0\nContent-Length: " + n + "\n\nbody\n"))
+	}
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		opts := []Option{
+			Lenient(),
+			KeepRaw(),
+			KeepRawHeader(),
+			KeepPreamble(),
+			Gunzip(),
+			MaxParts(100),
+			MaxDepth(10),
+		}
+		scan := NewScanner(bytes.NewReader(bs), opts...)
+		for i := 0; i < 10 && scan.Scan(); i++ {
+			fuzzMessage(scan.Message())
+		}
+		m, err := ReadMessage(bufio.NewReader(bytes.NewReader(bs)), opts...)
+		if err != nil && m.Header == nil {
+			return
+		}
+		fuzzMessage(m)
+	})
+}
+
+func fuzzMessage(m Message) {
+	m.Summary()
+	m.IndexDocument()
+	m.Validate()
+	m.QualityReport()
+	m.MissingCIDs()
+	m.TextBody()
+	m.TextDirection()
+	m.HasReadableBody()
+	m.Recipients()
+	m.ReplyTo()
+	m.References()
+	m.ReplyAttribution()
+	m.Attachments()
+	m.AttachmentsZip(io.Discard)
+	m.BouncedRecipients()
+	m.DecodedSubject()
+	m.SubjectCharsets()
+	m.ReadReceiptTo()
+	m.IsVacation()
+	m.SPF()
+	m.DKIM()
+	m.DMARC()
+	m.Fingerprint()
+	m.SignedPart()
+	m.EncryptedPart()
+	m.PreferredAlternative()
+	m.Each(func(_, _ string) {})
+	m.WalkParts(func(p Part, _ int) error {
+		p.Filename()
+		p.FilenameCharset()
+		p.ContentType()
+		p.Charset()
+		p.SniffedType()
+		p.IsFlowed()
+		p.Text()
+		p.HTML()
+		p.WriteTo(io.Discard)
+		return nil
+	})
+	WriteMessage(io.Discard, m)
+	m.OutboundHeader()
+}
+
+func FuzzParseContentType(f *testing.F) {
+	for _, str := range []string{
+		`multipart/mixed; boundary="unique-boundary"`,
+		`multipart; boundary=----=_Part_1`,
+		`text/plain; charset*=utf-8''%C3%A9; name*0="a"; name*1="b"`,
+		`text`,
+		`boundary=`,
+	} {
+		f.Add(str)
+	}
+	f.Fuzz(func(t *testing.T, str string) {
+		parseContentType(nil, str)
+		parseExtendedField(str)
+		rawBoundary(str)
+		completeSubType(str)
+	})
+}
+
+func FuzzParseAddresses(f *testing.F) {
+	for _, str := range []string{
+		`midbel <midbel@foobar.org>, "rustine" <rustine@foobar.org>`,
+		`<>`,
+		`,,`,
+		`=?utf-8?q?caf=C3=A9?= <cafe@foobar.org>`,
+	} {
+		f.Add(str)
+	}
+	f.Fuzz(func(t *testing.T, str string) {
+		parseAddresses(str)
+		parseAddressList(str)
+		NormalizeAddress(str)
+		decodeWords(str)
+		parseDate(str)
+	})
+}
@@ -0,0 +1,91 @@
+package mbox
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	maildirCur = "cur"
+	maildirNew = "new"
+	maildirTmp = "tmp"
+)
+
+// ToMaildir writes every message read from r as a file in the cur directory of
+// the Maildir rooted at dir. All messages are flagged as seen (S), and messages
+// having an In-Reply-To header are also flagged as replied (R). The
+// modification time of the files is set to the date of the From line of their
+// message, or to its Date header when the From line has none.
+func ToMaildir(r io.Reader, dir string) (int, error) {
+	for _, d := range []string{maildirCur, maildirNew, maildirTmp} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o700); err != nil {
+			return 0, err
+		}
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host)
+
+	var (
+		scan  = NewScanner(r)
+		count int
+	)
+	for scan.Scan() {
+		m := scan.Message()
+		if err := writeMaildir(dir, maildirName(m, count, host), m); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, scan.Err()
+}
+
+func maildirName(m Message, n int, host string) string {
+	flags := "S"
+	if m.IsReply() {
+		flags = "RS"
+	}
+	now := time.Now()
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s:2,%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), n+1, host, flags)
+}
+
+func writeMaildir(dir, name string, m Message) error {
+	tmp := filepath.Join(dir, maildirTmp, name)
+	w, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	ws := bufio.NewWriter(w)
+	if err := writeMessage(ws, m); err != nil {
+		w.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := ws.Flush(); err != nil {
+		w.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	when, ok := fromLineDate(m.FromLine)
+	if !ok {
+		when = m.Date()
+	}
+	if !when.IsZero() {
+		if err := os.Chtimes(tmp, when, when); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, filepath.Join(dir, maildirCur, name))
+}
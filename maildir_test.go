@@ -0,0 +1,102 @@
+package mbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToMaildir(t *testing.T) {
+	var buf bytes.Buffer
+	for _, f := range []string{"simple.txt", "reply.txt", "mixed.txt"} {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		buf.Write(bs)
+		buf.WriteString("\n")
+	}
+	dir := t.TempDir()
+	n, err := ToMaildir(&buf, dir)
+	if err != nil {
+		t.Fatalf("fail to convert mbox: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("wrong number of messages! want %d, got %d", 3, n)
+	}
+	for _, d := range []string{maildirNew, maildirTmp} {
+		es, err := os.ReadDir(filepath.Join(dir, d))
+		if err != nil || len(es) != 0 {
+			t.Errorf("%s: directory should exist and be empty", d)
+		}
+	}
+	es, err := os.ReadDir(filepath.Join(dir, maildirCur))
+	if err != nil {
+		t.Fatalf("fail to read cur directory: %s", err)
+	}
+	if len(es) != n {
+		t.Fatalf("wrong number of files! want %d, got %d", n, len(es))
+	}
+	var replied int
+	for _, e := range es {
+		if strings.HasSuffix(e.Name(), ":2,RS") {
+			replied++
+		} else if !strings.HasSuffix(e.Name(), ":2,S") {
+			t.Errorf("%s: unexpected flags", e.Name())
+		}
+		file := filepath.Join(dir, maildirCur, e.Name())
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", e.Name(), err)
+		}
+		if bytes.HasPrefix(bs, []byte(fromLinePrefix)) {
+			t.Errorf("%s: maildir file should not start with a From line", e.Name())
+		}
+		if !bytes.Contains(bs, []byte("Subject: "+defaultSubject)) {
+			t.Errorf("%s: subject header not found", e.Name())
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("fail to stat %s: %s", e.Name(), err)
+		}
+		want := time.Date(2020, 1, 22, 11, 15, 0, 0, time.UTC)
+		if bytes.Contains(bs, []byte("multipart/mixed")) {
+			want = time.Date(2020, 1, 21, 11, 15, 0, 0, time.UTC)
+		}
+		if !fi.ModTime().Equal(want) {
+			t.Errorf("%s: wrong mtime! want %s, got %s", e.Name(), want, fi.ModTime().UTC())
+		}
+	}
+	if replied != 1 {
+		t.Errorf("wrong number of replied messages! want %d, got %d", 1, replied)
+	}
+}
+
+func TestToMaildirDateFallback(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "simple.txt"))
+	if err != nil {
+		t.Fatalf("fail to read simple.txt: %s", err)
+	}
+	_, rest, _ := bytes.Cut(bs, []byte("\n"))
+	bs = append([]byte("From midbel@foobar.org\n"), rest...)
+
+	dir := t.TempDir()
+	if _, err := ToMaildir(bytes.NewReader(bs), dir); err != nil {
+		t.Fatalf("fail to convert mbox: %s", err)
+	}
+	es, err := os.ReadDir(filepath.Join(dir, maildirCur))
+	if err != nil || len(es) != 1 {
+		t.Fatalf("cur directory should contain one file")
+	}
+	fi, err := es[0].Info()
+	if err != nil {
+		t.Fatalf("fail to stat %s: %s", es[0].Name(), err)
+	}
+	want := time.Date(2020, 1, 22, 9, 15, 0, 0, time.UTC)
+	if !fi.ModTime().Equal(want) {
+		t.Errorf("wrong mtime! want %s, got %s", want, fi.ModTime().UTC())
+	}
+}
@@ -3,84 +3,319 @@ package mbox
 import (
 	"bufio"
 	"bytes"
-	"encoding/base64"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/quotedprintable"
+	"net/http"
 	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/midbel/mime"
 )
 
 const (
 	fromLinePrefix = "From "
+	byteOrderMark  = "\ufeff"
 
-	hdrMimeVersion     = "MIME-Version"
+	hdrMimeVersion     = "Mime-Version"
 	hdrContentType     = "Content-Type"
 	hdrContentLength   = "Content-Length"
 	hdrContentDispo    = "Content-Disposition"
 	hdrContentEncoding = "Content-Transfer-Encoding"
+	hdrContentCoding   = "Content-Encoding"
+	hdrContentLanguage = "Content-Language"
 
-	hdrDate       = "date"
-	hdrFrom       = "from"
-	hdrTo         = "to"
-	hdrCc         = "cc"
-	hdrSubject    = "subject"
-	hdrInReplyTo  = "in-reply-to"
-	hdrReferences = "references"
+	hdrDate       = "Date"
+	hdrFrom       = "From"
+	hdrSender     = "Sender"
+	hdrReplyTo    = "Reply-To"
+	hdrNotifyTo   = "Disposition-Notification-To"
+	hdrReceiptTo  = "Return-Receipt-To"
+	hdrTo         = "To"
+	hdrCc         = "Cc"
+	hdrBcc        = "Bcc"
+	hdrSubject    = "Subject"
+	hdrMessageID  = "Message-Id"
+	hdrInReplyTo  = "In-Reply-To"
+	hdrReferences = "References"
 
 	encBit7   = "7bit"
 	encBit8   = "8bit"
+	encBinary = "binary"
 	encBase64 = "base64"
 	encQuoted = "quoted-printable"
 
 	multiPart  = "multipart"
 	multiMixed = "mixed"
 	multiAlt   = "alternative"
+	multiSign  = "signed"
+	multiCrypt = "encrypted"
 	multiBound = "boundary"
+
+	octetStream = "application/octet-stream"
 )
 
 type Message struct {
+	FromLine string
 	Header
 	Parts []Part
+
+	Partial  bool
+	Raw      []byte
+	Preamble []byte
+	Epilog   []byte
+	// RawHeader is the verbatim header of the message, set by KeepRawHeader.
+	// Unlike Header, it keeps the order, the casing and the folding of the
+	// fields and should be used to verify signatures like DKIM.
+	RawHeader []byte
+
+	containers   []Part
+	groups       []partGroup
+	keys         []string
+	headerSize   int
+	unterminated bool
+	parser       ContentTypeParser
 }
 
-func ReadMessage(rs *bufio.Reader) (Message, error) {
-	var m Message
+// partGroup holds the parts of a multipart/signed or multipart/encrypted
+// container as they were before being flattened.
+type partGroup struct {
+	kind  string
+	parts []Part
+}
+
+func ReadMessage(rs *bufio.Reader, opts ...Option) (Message, error) {
+	return ReadMessageContext(context.Background(), rs, opts...)
+}
+
+func ReadMessageContext(ctx context.Context, rs *bufio.Reader, opts ...Option) (Message, error) {
+	r := newReader(ctx, opts...)
+	return r.read(rs)
+}
+
+func SkipToFirstMessage(rs *bufio.Reader) error {
+	r := newReader(context.Background())
+	r.src = rs
+	return r.skipToFirstMessage(rs)
+}
+
+func (r *reader) skipToFirstMessage(rs *bufio.Reader) error {
+	if bom, err := rs.Peek(len(byteOrderMark)); err == nil && string(bom) == byteOrderMark {
+		r.record(rs, bom)
+		rs.Discard(len(bom))
+	}
 	for {
-		line, err := rs.ReadString('\n')
-		if err == io.EOF {
-			return m, err
+		if r.atSeparator(rs) {
+			return nil
 		}
-		if line = strings.TrimSpace(line); line == "" {
-			continue
+		if _, err := rs.Peek(1); err != nil {
+			return err
+		}
+		if _, err := r.readLine(rs); err != nil {
+			return err
 		}
-		if !strings.HasPrefix(line, fromLinePrefix) {
-			return m, fmt.Errorf("expected From Line. Got %s", line)
+	}
+}
+
+// atSeparator reports whether the next line of rs is a From line starting a
+// new message.
+func (r *reader) atSeparator(rs *bufio.Reader) bool {
+	chunk, _ := rs.Peek(len(fromLinePrefix))
+	if string(chunk) != fromLinePrefix && !(r.sloppy && isSloppyPrefix(chunk)) {
+		return false
+	}
+	return r.isFromLine(peekLine(rs))
+}
+
+func (r *reader) isFromLine(line []byte) bool {
+	if r.strict || r.sloppy {
+		return validFromLine(line)
+	}
+	return bytes.HasPrefix(line, []byte(fromLinePrefix))
+}
+
+func isSloppyPrefix(chunk []byte) bool {
+	return len(chunk) == len(fromLinePrefix) && bytes.HasPrefix(chunk, []byte("From")) && chunk[4] == '\t'
+}
+
+func peekLine(rs *bufio.Reader) []byte {
+	for n := 128; ; n *= 2 {
+		if n > rs.Size() {
+			n = rs.Size()
+		}
+		chunk, err := rs.Peek(n)
+		if ix := bytes.IndexByte(chunk, '\n'); ix >= 0 {
+			return chunk[:ix]
+		}
+		if err != nil || n == rs.Size() {
+			return chunk
+		}
+	}
+}
+
+var fromLineDates = []string{
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+	"Mon Jan 2 15:04:05 -0700 2006",
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan 2 15:04:05 2006 MST",
+}
+
+// validFromLine reports whether line is made of "From" followed by spaces or
+// tabs, an address and a date.
+func validFromLine(line []byte) bool {
+	_, ok := fromLineDate(string(line))
+	return ok
+}
+
+// fromLineDate returns the date of the From line.
+func fromLineDate(line string) (time.Time, bool) {
+	if !strings.HasPrefix(line, "From") || len(line) <= 4 || (line[4] != ' ' && line[4] != '\t') {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(line[4:])
+	if len(fields) < 2 {
+		return time.Time{}, false
+	}
+	date := strings.Join(fields[1:], " ")
+	for _, layout := range fromLineDates {
+		if when, err := time.Parse(layout, date); err == nil {
+			return when, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (r *reader) read(rs *bufio.Reader) (Message, error) {
+	var now time.Time
+	if r.observer != nil {
+		now = time.Now()
+	}
+	m, err := r.readMessage(rs)
+	if err != nil && err != io.EOF {
+		err = &ParseError{
+			Offset: r.lineOffset,
+			Line:   r.line,
+			Err:    err,
 		}
-		break
 	}
-	hdr, err := readHeader(rs)
+	if r.observer != nil && (err != io.EOF || m.FromLine != "") {
+		r.observer(Stat{
+			Offset:  r.fromOffset,
+			Size:    r.offset - r.fromOffset,
+			Parts:   len(m.Parts),
+			Elapsed: time.Since(now),
+			Err:     err,
+		})
+	}
+	return m, err
+}
+
+func (r *reader) readMessage(rs *bufio.Reader) (Message, error) {
+	m := Message{parser: r.parser}
+	r.src = rs
+
+	var err error
+	if m.FromLine, err = r.readFromLine(rs); err != nil {
+		return m, err
+	}
+	r.capture = true
+
+	r.tee, r.teeing = nil, r.keepRawHeader
+	hdr, keys, size, err := r.readHeader(rs)
+	if r.keepRawHeader {
+		m.RawHeader = r.tee
+	}
+	r.tee, r.teeing = nil, false
 	if err != nil {
 		return m, err
 	}
-	m.Header = hdr
+	m.Header, m.keys, m.headerSize = hdr, keys, size
 
 	if !m.IsMultipart() {
-		return m, readPlain(rs, &m)
+		err := r.readPlain(rs, &m)
+		m.Raw = r.raw
+		return m, err
+	}
+	mt, err := m.mediaType()
+	if err != nil {
+		return m, err
+	}
+	ps, err := r.readBody(rs, []byte("--"+mt.Params[multiBound]), nil, intactKind(mt))
+	if errors.Is(err, ErrUnterminatedPart) {
+		if r.lenient {
+			m.Parts = append(m.Parts, ps...)
+			m.Raw = r.raw
+			m.unterminated = true
+		}
+		return m, err
+	}
+	if errors.Is(err, ErrBoundaryMismatch) && r.lenient {
+		m.Raw = r.raw
+		return m, r.ctx.Err()
 	}
-	mt, err := mime.Parse(m.Get(hdrContentType))
 	if err != nil {
 		return m, err
 	}
-	ps, err := readBody(rs, []byte("--"+mt.Params[multiBound]), nil)
-	if err == nil {
-		m.Parts = append(m.Parts, ps...)
+	m.Parts = append(m.Parts, ps...)
+	m.Partial = r.partial
+	m.Raw = r.raw
+	m.Preamble, m.Epilog = r.preamble, r.epilog
+	m.containers = r.containers
+	m.groups = r.groups
+	return m, r.ctx.Err()
+}
+
+func (r *reader) readFromLine(rs *bufio.Reader) (string, error) {
+	if r.lenient {
+		if err := r.skipToFirstMessage(rs); err != nil {
+			return "", err
+		}
+	}
+	for {
+		line, err := r.readLine(rs)
+		if err == io.EOF {
+			return "", err
+		}
+		if err != nil && len(line) == 0 {
+			return "", err
+		}
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		if !r.isFromLine(line) {
+			return "", fmt.Errorf("expected From Line. Got %s", line)
+		}
+		r.fromOffset = r.lineOffset
+		return string(line), nil
+	}
+}
+
+func (r *reader) partPath() string {
+	list := make([]string, len(r.path))
+	for i := range r.path {
+		list[i] = strconv.Itoa(r.path[i])
+	}
+	return strings.Join(list, ".")
+}
+
+func (r *reader) readLine(rs *bufio.Reader) ([]byte, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if rs == r.src {
+		r.lineOffset, r.line = r.offset, r.lines+1
 	}
-	return m, nil
+	line, err := rs.ReadBytes('\n')
+	r.record(rs, line)
+	return line, err
 }
 
 func (m Message) Filter(fn func(Header) bool) []Part {
@@ -93,6 +328,161 @@ func (m Message) Filter(fn func(Header) bool) []Part {
 	return as
 }
 
+func (m Message) FilterErr(fn func(Part) (bool, error)) ([]Part, error) {
+	as := make([]Part, 0, len(m.Parts))
+	for _, p := range m.Parts {
+		ok, err := fn(p)
+		if err != nil {
+			return as, err
+		}
+		if ok {
+			as = append(as, p)
+		}
+	}
+	return as, nil
+}
+
+func (m Message) WalkParts(fn func(Part, int) error) error {
+	ps := make([]Part, 0, len(m.Parts)+len(m.containers))
+	ps = append(ps, m.containers...)
+	ps = append(ps, m.bodyParts()...)
+	sort.SliceStable(ps, func(i, j int) bool {
+		return comparePath(ps[i].path, ps[j].path) < 0
+	})
+	for _, p := range ps {
+		if err := fn(p, strings.Count(p.path, ".")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Each calls fn for every field of the header of the message and of its parts,
+// with the fields of the parts prefixed by their path (eg: "1.2/Content-Type").
+// The fields of a header are visited in the order given by Keys and the parts
+// in the order of WalkParts.
+func (m Message) Each(fn func(field, value string)) {
+	m.Header.each("", m.Keys(), fn)
+	if !m.IsMultipart() {
+		return
+	}
+	m.WalkParts(func(p Part, _ int) error {
+		p.Header.each(p.path+"/", p.Keys(), fn)
+		return nil
+	})
+}
+
+// Clone returns a deep copy of the message: the headers and the bodies of the
+// message and of its parts can be modified without affecting m.
+func (m Message) Clone() Message {
+	c := m
+	c.Header = m.Header.Clone()
+	c.Parts = cloneParts(m.Parts)
+	c.Raw = cloneBytes(m.Raw)
+	c.RawHeader = cloneBytes(m.RawHeader)
+	c.Preamble = cloneBytes(m.Preamble)
+	c.Epilog = cloneBytes(m.Epilog)
+	c.keys = append([]string(nil), m.keys...)
+	c.containers = cloneParts(m.containers)
+	c.groups = nil
+	for _, g := range m.groups {
+		c.groups = append(c.groups, partGroup{kind: g.kind, parts: cloneParts(g.parts)})
+	}
+	return c
+}
+
+func (p Part) clone() Part {
+	c := p
+	c.Header = p.Header.Clone()
+	c.Body = cloneBytes(p.Body)
+	c.raw = cloneBytes(p.raw)
+	c.keys = append([]string(nil), p.keys...)
+	return c
+}
+
+func cloneParts(ps []Part) []Part {
+	if ps == nil {
+		return nil
+	}
+	cs := make([]Part, len(ps))
+	for i := range ps {
+		cs[i] = ps[i].clone()
+	}
+	return cs
+}
+
+func cloneBytes(bs []byte) []byte {
+	if bs == nil {
+		return nil
+	}
+	return append([]byte{}, bs...)
+}
+
+// Keys returns the fields of the header of the message in the order they
+// first appear in the mailbox. The fields added after the message has been
+// read come last, in sorted order.
+func (m Message) Keys() []string {
+	return orderKeys(m.Header, m.keys)
+}
+
+// MapHeaders calls fn with each field of the header of the message, in the
+// order given by Keys, and replaces its values with the ones returned by fn. The
+// field is deleted when fn returns nil or an empty list.
+//
+// Deleting or rewriting the Content-Type of a multipart message would make its
+// parts unreadable once written: the Mime-Version and Content-Type fields of
+// the multipart messages are therefore not given to fn.
+func (m *Message) MapHeaders(fn func(key string, values []string) []string) {
+	multipart := m.IsMultipart()
+	for _, k := range m.Keys() {
+		if multipart && (k == hdrContentType || k == hdrMimeVersion) {
+			continue
+		}
+		if vs := fn(k, m.Header[k]); len(vs) > 0 {
+			m.Header[k] = vs
+		} else {
+			delete(m.Header, k)
+		}
+	}
+}
+
+// SignedPart returns the two parts of the first multipart/signed container of
+// the message: the signed content and the signature. The signed content is not
+// flattened and its Raw bytes are the ones covered by the signature.
+func (m Message) SignedPart() (Part, Part, bool) {
+	return m.intactParts(multiSign)
+}
+
+// EncryptedPart returns the two parts of the first multipart/encrypted
+// container of the message: the control information and the encrypted data.
+func (m Message) EncryptedPart() (Part, Part, bool) {
+	return m.intactParts(multiCrypt)
+}
+
+func (m Message) intactParts(kind string) (Part, Part, bool) {
+	for _, g := range m.groups {
+		if g.kind == kind && len(g.parts) == 2 {
+			return g.parts[0], g.parts[1], true
+		}
+	}
+	return Part{}, Part{}, false
+}
+
+func comparePath(a, b string) int {
+	var (
+		as = strings.Split(a, ".")
+		bs = strings.Split(b, ".")
+	)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x != y {
+			return x - y
+		}
+	}
+	return len(as) - len(bs)
+}
+
 func (m Message) Part(mt string) Part {
 	var p Part
 	if mt == "" {
@@ -107,6 +497,140 @@ func (m Message) Part(mt string) Part {
 	return p
 }
 
+func (m Message) TextBody() string {
+	var html string
+	for _, p := range m.bodyParts() {
+		if p.IsAttachment() {
+			continue
+		}
+		switch p.DeclaredType() {
+		case "", "text/plain":
+			return p.TextString()
+		case "text/html":
+			if html == "" {
+				html = stripTags(p.TextString())
+			}
+		}
+	}
+	return html
+}
+
+// PreferredAlternative returns the part of the first multipart/alternative
+// container of the message matching the acceptable types, given in decreasing
+// order of preference. As the alternatives are ordered from the simplest to
+// the richest, the last one is used when several have the same type, and when
+// no types are given. An alternative made of a nested container, such as a
+// multipart/related, is represented by its first part. When the message has
+// no multipart/alternative container, its parts that are not attachments are
+// the alternatives.
+func (m Message) PreferredAlternative(types ...string) (Part, bool) {
+	var all []Part
+	m.WalkParts(func(p Part, _ int) error {
+		all = append(all, p)
+		return nil
+	})
+	prefix, found := "", m.IsMultipart() && m.isAlternative()
+	for _, p := range all {
+		if found {
+			break
+		}
+		if p.IsMultipart() && p.DeclaredType() == multiPart+"/"+multiAlt {
+			prefix, found = p.path+".", true
+		}
+	}
+	var list []Part
+	for _, p := range all {
+		if !found {
+			if !p.IsMultipart() && !p.IsAttachment() {
+				list = append(list, p)
+			}
+			continue
+		}
+		rest := strings.TrimPrefix(p.path, prefix)
+		if !strings.HasPrefix(p.path, prefix) || strings.Contains(rest, ".") {
+			continue
+		}
+		if p.IsMultipart() {
+			var ok bool
+			if p, ok = firstLeaf(all, p.path+"."); !ok {
+				continue
+			}
+		}
+		list = append(list, p)
+	}
+	if len(list) == 0 {
+		return Part{}, false
+	}
+	if len(types) == 0 {
+		return list[len(list)-1], true
+	}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		for i := len(list) - 1; i >= 0; i-- {
+			mt := list[i].DeclaredType()
+			if mt == "" {
+				mt = "text/plain"
+			}
+			if mt == t {
+				return list[i], true
+			}
+		}
+	}
+	return Part{}, false
+}
+
+func (m Message) isAlternative() bool {
+	mt, err := m.mediaType()
+	return err == nil && strings.EqualFold(mt.SubType, multiAlt)
+}
+
+func firstLeaf(ps []Part, prefix string) (Part, bool) {
+	for _, p := range ps {
+		if strings.HasPrefix(p.path, prefix) && !p.IsMultipart() {
+			return p, true
+		}
+	}
+	return Part{}, false
+}
+
+// HasReadableBody reports whether the message has a non empty text/plain or
+// text/html part that is not an attachment.
+func (m Message) HasReadableBody() bool {
+	for _, p := range m.bodyParts() {
+		if p.IsAttachment() {
+			continue
+		}
+		var text string
+		switch main, sub := p.ContentType(); {
+		case main == "text" && sub == "plain":
+			text = p.TextString()
+		case main == "text" && sub == "html":
+			text = stripTags(p.TextString())
+		}
+		if strings.TrimSpace(text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (m Message) bodyParts() []Part {
+	if m.IsMultipart() || len(m.Parts) != 1 {
+		return m.Parts
+	}
+	var (
+		p   = m.Parts[0]
+		hdr = make(Header)
+	)
+	for k, vs := range m.Header {
+		if strings.HasPrefix(k, "Content-") {
+			hdr[k] = vs
+		}
+	}
+	p.Header = hdr
+	return []Part{p}
+}
+
 func (m Message) Files() []string {
 	files := make([]string, 0, len(m.Parts))
 	for _, p := range m.Parts {
@@ -117,8 +641,15 @@ func (m Message) Files() []string {
 	return files
 }
 
+// HeaderSize returns the number of bytes of the header block of the message,
+// including the blank line ending it but not the From line.
+func (m Message) HeaderSize() int {
+	return m.headerSize
+}
+
 func (m Message) Date() time.Time {
-	return parseTime(m.Get(hdrDate)).UTC()
+	when, _ := m.Header.Date(hdrDate)
+	return when.UTC()
 }
 
 func (m Message) Subject() string {
@@ -126,135 +657,595 @@ func (m Message) Subject() string {
 }
 
 func (m Message) From() string {
-	return parseAddress(m.Get(hdrFrom))
+	as, _ := m.AddressList(hdrFrom)
+	if len(as) == 0 {
+		return ""
+	}
+	return as[0].Addr
+}
+
+// Sender returns the address of the Sender header, the mailbox that actually
+// sent the message. It defaults to the first address of the From header when
+// the message has no Sender.
+func (m Message) Sender() Address {
+	as, _ := m.AddressList(hdrSender)
+	if len(as) == 0 {
+		as, _ = m.AddressList(hdrFrom)
+	}
+	if len(as) == 0 {
+		return Address{}
+	}
+	return as[0]
+}
+
+func (m Message) ReplyTo() []Address {
+	as, _ := m.AddressList(hdrReplyTo)
+	return as
+}
+
+// ReadReceiptTo returns the bare address to which a read receipt should be
+// sent, taken from the Disposition-Notification-To header or from the legacy
+// Return-Receipt-To header. It returns an empty string when no receipt is
+// requested.
+func (m Message) ReadReceiptTo() string {
+	for _, k := range []string{hdrNotifyTo, hdrReceiptTo} {
+		as, _ := m.AddressList(k)
+		for _, a := range as {
+			if addr := strings.Trim(a.Addr, "<> "); addr != "" {
+				return addr
+			}
+		}
+	}
+	return ""
+}
+
+func (m Message) IsReadReceiptRequested() bool {
+	return m.ReadReceiptTo() != ""
 }
 
 func (m Message) To() []string {
-	return parseAddressList(m.Get(hdrTo))
+	as, _ := m.AddressList(hdrTo)
+	return addressStrings(as)
 }
 
 func (m Message) Cc() []string {
-	return parseAddressList(m.Get(hdrCc))
+	as, _ := m.AddressList(hdrCc)
+	return addressStrings(as)
+}
+
+func (m Message) Bcc() []string {
+	as, _ := m.AddressList(hdrBcc)
+	return addressStrings(as)
+}
+
+func (m Message) Recipients() []string {
+	var (
+		list []string
+		seen = make(map[string]struct{})
+	)
+	for _, k := range []string{hdrTo, hdrCc, hdrBcc} {
+		as, _ := m.AddressList(k)
+		for _, a := range as {
+			addr := NormalizeAddress(a.Addr)
+			if _, ok := seen[addr]; ok || addr == "" {
+				continue
+			}
+			seen[addr] = struct{}{}
+			list = append(list, addr)
+		}
+	}
+	return list
+}
+
+func (m Message) ContentLength() (int, bool) {
+	if !m.Has(hdrContentLength) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m.Get(hdrContentLength))
+	return n, err == nil && n >= 0
 }
 
 func (m Message) IsMime() bool {
 	return m.Has(hdrMimeVersion)
 }
 
+// IsMultipart reports whether the message is a multipart message whose parts
+// can be read, that is with a boundary. A multipart message without boundary
+// is read as a plain message.
 func (m Message) IsMultipart() bool {
+	mt, ok := m.declaredMultipart()
+	return ok && mt.hasBoundary()
+}
+
+func (m Message) declaredMultipart() (mediaType, bool) {
 	if !m.IsMime() {
-		return false
+		return mediaType{}, false
 	}
-	mt, _ := mime.Parse(m.Get(hdrContentType))
-	return mt.MainType == multiPart
+	mt, err := m.mediaType()
+	return mt, err == nil && mt.MainType == multiPart
 }
 
 func (m Message) IsReply() bool {
 	return m.Has(hdrInReplyTo)
 }
 
+func (m Message) MessageID() string {
+	ids := parseMessageIDs(m.Get(hdrMessageID))
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[0]
+}
+
+func (m Message) InReplyTo() []string {
+	return parseMessageIDs(m.Get(hdrInReplyTo))
+}
+
+func (m Message) References() []string {
+	return parseMessageIDs(m.Get(hdrReferences))
+}
+
+// HasAttachments reports whether the message has at least one attachment, as
+// defined by Attachments.
 func (m Message) HasAttachments() bool {
-	for _, p := range m.Parts {
-		if p.IsAttachment() {
-			return true
+	return len(m.Attachments()) > 0
+}
+
+// Attachments returns the parts of the message, nested or not, whose
+// Content-Disposition is attachment. The inline parts, even with a filename,
+// and the multipart containers are not attachments.
+func (m Message) Attachments() []Part {
+	var list []Part
+	for _, p := range m.bodyParts() {
+		if p.IsAttachment() && !p.IsMultipart() {
+			list = append(list, p)
 		}
 	}
-	return false
+	return list
+}
+
+// AttachmentTypes returns the lowercased media types (type/subtype) of the
+// attachments of the message, in the order of Attachments.
+func (m Message) AttachmentTypes() []string {
+	var list []string
+	for _, p := range m.Attachments() {
+		main, sub := p.ContentType()
+		list = append(list, main+"/"+sub)
+	}
+	return list
 }
 
 type Part struct {
 	Header
 	Body []byte
+
+	path       string
+	charset    string
+	gunzip     bool
+	truncated  bool
+	raw        []byte
+	keys       []string
+	headerSize int
+	parser     ContentTypeParser
+}
+
+func (p Part) Path() string {
+	return p.path
+}
+
+// Keys returns the fields of the header of the part in the order they first
+// appear in the mailbox, as Message.Keys does.
+func (p Part) Keys() []string {
+	return orderKeys(p.Header, p.keys)
+}
+
+// Raw returns the bytes of the part, header included, exactly as they appear in
+// the message. They are only kept for the parts of multipart/signed and
+// multipart/encrypted containers, as returned by SignedPart and EncryptedPart.
+func (p Part) Raw() []byte {
+	return p.raw
+}
+
+// Truncated reports whether the body of the part has been cut to the size set
+// with MaxPartSize.
+func (p Part) Truncated() bool {
+	return p.truncated
+}
+
+// HeaderSize returns the number of bytes of the header block of the part as
+// found in the source, including the blank line ending it.
+func (p Part) HeaderSize() int {
+	return p.headerSize
 }
 
 func (p Part) Len() int {
 	return len(p.Body)
 }
 
-func (p Part) Text() []byte {
-	mt, err := mime.Parse(p.Get(hdrContentType))
-	if err != nil {
-		return nil
+func (p Part) Size() int {
+	return len(p.decodeBody())
+}
+
+func (p Part) Text() []byte {
+	mt, err := p.mediaType()
+	if err != nil {
+		return nil
+	}
+	var str []byte
+	if mt.MainType == "text" && mt.SubType == "plain" {
+		str = p.decodeBody()
+	}
+	return str
+}
+
+func (p Part) HTML() []byte {
+	mt, err := p.mediaType()
+	if err != nil {
+		return nil
+	}
+	var str []byte
+	if mt.MainType == "text" && mt.SubType == "html" {
+		str = p.decodeBody()
+	}
+	return str
+}
+
+func (p Part) TextString() string {
+	var (
+		body    = p.decodeBody()
+		charset = p.Charset()
+		delsp   bool
+	)
+	if charset == "" {
+		charset = p.charset
+	}
+	if charset == "" {
+		charset = charsetASCII
+	}
+	if mt, err := p.mediaType(); err == nil {
+		delsp = strings.EqualFold(mt.Params["delsp"], "yes")
+	}
+	body, _ = decodeCharset(charset, body)
+	if p.IsFlowed() {
+		return unflow(string(body), delsp)
+	}
+	return string(body)
+}
+
+func (p Part) IsFlowed() bool {
+	mt, err := p.mediaType()
+	if err != nil {
+		return false
+	}
+	return mt.MainType == "text" && mt.SubType == "plain" && strings.EqualFold(mt.Params["format"], "flowed")
+}
+
+func (p Part) Bytes() []byte {
+	return p.decodeBody()
+}
+
+func (p Part) DecodedBody() ([]byte, error) {
+	return p.decode()
+}
+
+// WriteTo writes the decoded body of the part to w without buffering it
+// first. It returns the number of bytes written and the first error that
+// occurred while decoding or writing the body.
+func (p Part) WriteTo(w io.Writer) (int64, error) {
+	rs := p.transferReader()
+	if p.gunzip && p.isGzip() {
+		z, err := gzip.NewReader(rs)
+		if err != nil {
+			return 0, err
+		}
+		defer z.Close()
+		rs = z
+	}
+	n, err := io.Copy(w, rs)
+	if err == nil && p.encoding() == encBit7 {
+		err = check7bit(p.Body)
+	}
+	return n, err
+}
+
+// ContentType returns the lowercased type and subtype of the part. A part
+// without Content-Type is text/plain as defined by RFC 2045.
+func (p Part) ContentType() (string, string) {
+	if !p.Has(hdrContentType) {
+		return "text", "plain"
+	}
+	mt, err := p.mediaType()
+	if err != nil {
+		return "", ""
+	}
+	return strings.ToLower(mt.MainType), strings.ToLower(mt.SubType)
+}
+
+// Charset returns the lowercased charset of the part. Text parts that do not
+// declare one get the default charset of the reader, us-ascii unless changed
+// with DefaultCharset.
+func (p Part) Charset() string {
+	mt, err := p.mediaType()
+	if err == nil && mt.Params["charset"] != "" {
+		return strings.ToLower(mt.Params["charset"])
+	}
+	if main, _ := p.ContentType(); main != "text" {
+		return ""
+	}
+	if p.charset == "" {
+		return charsetASCII
+	}
+	return p.charset
+}
+
+func (p Part) Boundary() string {
+	mt, err := p.mediaType()
+	if err != nil || !strings.EqualFold(mt.MainType, multiPart) {
+		return ""
+	}
+	return mt.Params[multiBound]
+}
+
+func (p Part) DeclaredType() string {
+	mt, err := p.mediaType()
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mt.MainType + "/" + mt.SubType)
+}
+
+func (p Part) SniffedType() string {
+	declared := p.DeclaredType()
+	if declared != "" && declared != octetStream {
+		return declared
+	}
+	sniffed := http.DetectContentType(p.decodeBody())
+	if ix := strings.Index(sniffed, ";"); ix >= 0 {
+		sniffed = sniffed[:ix]
+	}
+	return sniffed
+}
+
+func (p Part) Filename() string {
+	hdr, ps := parseValueField(p.Get(hdrContentDispo))
+	if p.IsAttachment() || p.IsInline() {
+		hdr = ps["filename"]
+		if hdr == "" {
+			mt, err := p.mediaType()
+			if err == nil {
+				hdr = mt.Params["name"]
+			}
+		}
+	} else {
+		hdr = ""
+	}
+	return decodeWords(hdr)
+}
+
+// FilenameCharset returns the charset used to encode the filename of the
+// part, either with RFC 2231 extended parameters (filename*=utf-8'en'name) or
+// with RFC 2047 encoded words. An empty string is returned for plain names.
+func (p Part) FilenameCharset() string {
+	params := []struct {
+		Value string
+		Name  string
+	}{
+		{Value: p.Get(hdrContentDispo), Name: "filename"},
+		{Value: p.contentType(), Name: "name"},
+	}
+	for _, param := range params {
+		_, ps, charsets := parseExtendedField(param.Value)
+		if cs := charsets[param.Name]; cs != "" {
+			return cs
+		}
+		if cs := wordCharsets(ps[param.Name]); len(cs) > 0 {
+			return cs[0]
+		}
+	}
+	return ""
+}
+
+func (p Part) Filenames() (string, string) {
+	var disposition, typeName string
+	if _, ps := parseValueField(p.Get(hdrContentDispo)); ps != nil {
+		disposition = ps["filename"]
+	}
+	if mt, err := p.mediaType(); err == nil {
+		typeName = mt.Params["name"]
+	}
+	return disposition, typeName
+}
+
+func (p Part) IsAttachment() bool {
+	hdr, _ := parseValueField(p.Get(hdrContentDispo))
+	return strings.EqualFold(hdr, "attachment")
+}
+
+func (p Part) IsInline() bool {
+	hdr, _ := parseValueField(p.Get(hdrContentDispo))
+	return strings.EqualFold(hdr, "inline")
+}
+
+func (p Part) IsMultipart() bool {
+	mt, err := p.mediaType()
+	return err == nil && mt.MainType == multiPart && mt.hasBoundary()
+}
+
+func (p Part) encoding() string {
+	if p.IsMultipart() {
+		// RFC 2045 forbids any encoding other than 7bit, 8bit or binary on
+		// multipart entities: subparts are always read from the raw body.
+		return ""
+	}
+	return p.declaredEncoding()
+}
+
+// Encoding returns the lowercased Content-Transfer-Encoding of the part. It
+// returns 7bit, the default defined by RFC 2045, when the part does not declare
+// one and for the multipart containers.
+func (p Part) Encoding() string {
+	if enc := p.encoding(); enc != "" {
+		return enc
+	}
+	return encBit7
+}
+
+func (p Part) declaredEncoding() string {
+	return strings.ToLower(strings.TrimSpace(stripComments(p.Get(hdrContentEncoding))))
+}
+
+// containerBody returns the body of a multipart part. Some mailers encode the
+// whole container in base64 or quoted-printable, against RFC 2045: its body is
+// then decoded so that its parts can be read. Containers that only carry the
+// label, their delimiters being found in the raw body, are left untouched to
+// not decode their parts twice.
+func (p Part) containerBody() []byte {
+	switch enc := p.declaredEncoding(); enc {
+	case encBase64, encQuoted:
+		if hasDelimiter(p.Body, []byte("--"+p.Boundary())) {
+			break
+		}
+		if body, err := ioutil.ReadAll(decodeReader(enc, p.Body)); err == nil {
+			return body
+		}
+	}
+	return p.Body
+}
+
+func hasDelimiter(body, boundary []byte) bool {
+	for len(body) > 0 {
+		var line []byte
+		if ix := bytes.IndexByte(body, '\n'); ix >= 0 {
+			line, body = body[:ix], body[ix+1:]
+		} else {
+			line, body = body, nil
+		}
+		if ok, _ := matchBoundary(line, boundary); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func stripComments(str string) string {
+	var (
+		buf   strings.Builder
+		depth int
+	)
+	for _, r := range str {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func (p Part) decodeBody() []byte {
+	body, _ := p.decode()
+	return body
+}
+
+func (p Part) decode() ([]byte, error) {
+	body, err := p.decodeTransfer()
+	if err != nil || !p.gunzip || !p.isGzip() {
+		return body, err
 	}
-	var str []byte
-	if mt.MainType == "text" && mt.SubType == "plain" {
-		str = p.decodeBody()
+	rs, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
-	return str
+	defer rs.Close()
+	return ioutil.ReadAll(rs)
 }
 
-func (p Part) HTML() []byte {
-	mt, err := mime.Parse(p.Get(hdrContentType))
-	if err != nil {
-		return nil
-	}
-	var str []byte
-	if mt.MainType == "text" && mt.SubType == "html" {
-		str = p.decodeBody()
+func (p Part) isGzip() bool {
+	switch strings.ToLower(strings.TrimSpace(stripComments(p.Get(hdrContentCoding)))) {
+	case "gzip", "x-gzip":
+		return true
+	default:
+		return false
 	}
-	return str
 }
 
-func (p Part) Bytes() []byte {
-	return p.decodeBody()
+func (p Part) decodeTransfer() ([]byte, error) {
+	switch p.encoding() {
+	case encBase64, encQuoted:
+		return ioutil.ReadAll(p.transferReader())
+	case encBit7:
+		return p.Body, check7bit(p.Body)
+	default:
+		return p.Body, nil
+	}
 }
 
-func (p Part) Filename() string {
-	hdr, ps := parseValueField(p.Get(hdrContentDispo))
-	if hdr == "attachment" || hdr == "inline" {
-		hdr = ps["filename"]
-		if hdr == "" {
-			mt, err := mime.Parse(p.Get(hdrContentType))
-			if err == nil {
-				hdr = mt.Params["name"]
-			}
+// ErrNot7bit is returned when decoding a part labeled 7bit whose body contains
+// 8-bit or NUL bytes.
+var ErrNot7bit = errors.New("8-bit data in 7bit part")
+
+func check7bit(body []byte) error {
+	for i, b := range body {
+		if b == 0 || b >= 0x80 {
+			return fmt.Errorf("%w: byte %#02x at offset %d", ErrNot7bit, b, i)
 		}
-	} else {
-		hdr = ""
 	}
-	return hdr
+	return nil
 }
 
-func (p Part) IsAttachment() bool {
-	hdr, _ := parseValueField(p.Get(hdrContentDispo))
-	return hdr == "attachment"
+func (p Part) transferReader() io.Reader {
+	return decodeReader(p.encoding(), p.Body)
 }
 
-func (p Part) IsInline() bool {
-	hdr, _ := parseValueField(p.Get(hdrContentDispo))
-	return hdr == "inline"
+func decodeReader(enc string, body []byte) io.Reader {
+	rs := io.Reader(bytes.NewReader(body))
+	switch enc {
+	case encBase64:
+		rs = newBase64Reader(rs)
+	case encQuoted:
+		rs = quotedprintable.NewReader(rs)
+	}
+	return rs
 }
 
-func (p Part) IsMultipart() bool {
-	mt, _ := mime.Parse(p.Get(hdrContentType))
-	return mt.MainType == multiPart
+type Header map[string][]string
+
+// Keys returns the fields of the header in sorted order.
+func (h Header) Keys() []string {
+	return orderKeys(h, nil)
 }
 
-func (p Part) decodeBody() []byte {
-	var rs io.Reader
-	switch enc := p.Get(hdrContentEncoding); strings.ToLower(enc) {
-	case encBase64:
-		var (
-			scan = bufio.NewScanner(bytes.NewReader(p.Body))
-			ws   bytes.Buffer
-		)
-		for scan.Scan() {
-			ws.Write(scan.Bytes())
-		}
-		if err := scan.Err(); err != nil {
-			return nil
+func (h Header) each(prefix string, keys []string, fn func(string, string)) {
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fn(prefix+k, v)
 		}
-		rs = base64.NewDecoder(base64.StdEncoding, &ws)
-	case encQuoted:
-		rs = quotedprintable.NewReader(bytes.NewReader(p.Body))
-	default:
-		return p.Body
 	}
-	body, _ := ioutil.ReadAll(rs)
-	return body
 }
 
-type Header map[string][]string
+func orderKeys(hdr Header, order []string) []string {
+	var (
+		keys = make([]string, 0, len(hdr))
+		rest = make([]string, 0, len(hdr))
+		seen = make(map[string]struct{})
+	)
+	for _, k := range order {
+		if _, ok := hdr[k]; ok {
+			keys = append(keys, k)
+			seen[k] = struct{}{}
+		}
+	}
+	for k := range hdr {
+		if _, ok := seen[k]; !ok {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
 
 func (h Header) Has(k string) bool {
 	k = textproto.CanonicalMIMEHeaderKey(k)
@@ -277,6 +1268,24 @@ func (h Header) Get(k string) string {
 	return k
 }
 
+func (h Header) Values(k string) []string {
+	return h[textproto.CanonicalMIMEHeaderKey(k)]
+}
+
+func (h Header) Date(k string) (time.Time, error) {
+	if !h.Has(k) {
+		return time.Time{}, fmt.Errorf("%s: header not found", k)
+	}
+	return parseDate(h.Get(k))
+}
+
+func (h Header) AddressList(k string) ([]Address, error) {
+	if !h.Has(k) {
+		return nil, fmt.Errorf("%s: header not found", k)
+	}
+	return parseAddresses(h.Get(k))
+}
+
 func (h Header) Split(k string) (string, map[string]string) {
 	k = textproto.CanonicalMIMEHeaderKey(k)
 	vs, ok := h[k]
@@ -313,120 +1322,397 @@ func (h Header) Del(k string) {
 	delete(h, k)
 }
 
-func readBody(rs *bufio.Reader, boundary, parent []byte) ([]Part, error) {
+// Clone returns a copy of the header that can be modified without affecting h.
+func (h Header) Clone() Header {
+	if h == nil {
+		return nil
+	}
+	c := make(Header, len(h))
+	for k, vs := range h {
+		c[k] = append([]string(nil), vs...)
+	}
+	return c
+}
+
+func (r *reader) readBody(rs *bufio.Reader, boundary, parent []byte, kind string) ([]Part, error) {
 	if bytes.Equal(boundary, []byte("--")) {
 		return nil, fmt.Errorf("empty boundary delimiter")
 	}
+	if r.maxDepth > 0 && len(r.path) >= r.maxDepth {
+		return nil, ErrTooDeep
+	}
 
-	if err := skipProlog(rs, boundary); err != nil {
+	top := len(r.path) == 0
+	if err := r.skipProlog(rs, boundary, top); err != nil {
 		return nil, err
 	}
+	r.path = append(r.path, 0)
+	r.boundaries = append(r.boundaries, boundary)
+	defer func() {
+		r.path = r.path[:len(r.path)-1]
+		r.boundaries = r.boundaries[:len(r.boundaries)-1]
+	}()
+
+	group := -1
+	if kind != "" {
+		group = len(r.groups)
+		r.groups = append(r.groups, partGroup{kind: kind})
+	}
 	var ps []Part
 	for {
-		xs, err := readPart(rs, boundary, parent)
-		if err == nil || err == io.EOF {
-			ps = append(ps, xs...)
-		}
+		xs, last, err := r.readPart(rs, boundary, parent, group)
+		ps = append(ps, xs...)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, err
+			return ps, err
+		}
+		if last {
+			break
+		}
+		if r.preview && (r.partial || hasTextBody(xs)) {
+			r.partial = true
+			break
+		}
+	}
+	return ps, r.skipEpilog(rs, parent, top)
+}
+
+func hasTextBody(ps []Part) bool {
+	for _, p := range ps {
+		if p.IsAttachment() {
+			continue
+		}
+		if t := p.DeclaredType(); t == "text/plain" || t == "text/html" {
+			return true
 		}
 	}
-	return ps, skipEpilog(rs, parent)
+	return false
 }
 
-func readPart(rs *bufio.Reader, boundary, parent []byte) ([]Part, error) {
+func (r *reader) readPart(rs *bufio.Reader, boundary, parent []byte, group int) ([]Part, bool, error) {
 	var (
-		part Part
-		err  error
-		str  []byte
-		line []byte
+		part  Part
+		err   error
+		line  []byte
+		found bool
+		last  bool
 	)
-	if part.Header, err = readHeader(rs); err != nil {
-		return nil, err
+	if r.parts++; r.maxParts > 0 && r.parts > r.maxParts {
+		return nil, false, ErrTooManyParts
+	}
+	r.tee, r.teeing = nil, group >= 0
+	defer func() {
+		r.tee, r.teeing = nil, false
+	}()
+	if part.Header, part.keys, part.headerSize, err = r.readHeader(rs); err != nil {
+		return nil, false, err
+	}
+	part.charset = r.charset
+	part.gunzip = r.gunzip
+	part.parser = r.parser
+	r.path[len(r.path)-1]++
+	part.path = r.partPath()
+	container := part.IsMultipart()
+	if container {
+		if err := r.checkBoundary(part); err != nil {
+			return nil, false, err
+		}
 	}
 	for {
-		line, err = rs.ReadBytes('\n')
-		if err != nil {
-			return nil, err
+		if parent == nil && r.atSeparator(rs) {
+			err = io.EOF
+			break
+		}
+		line, err = r.readLine(rs)
+		if found, last = matchBoundary(line, boundary); found {
+			break
+		}
+		if container {
+			part.Body = append(part.Body, line...)
+		} else {
+			r.accumulate(&part, line)
 		}
-		if bytes.HasPrefix(line, boundary) {
-			str = bytes.TrimSpace(line)
+		if err != nil {
 			break
 		}
-		part.Body = append(part.Body, line...)
 	}
-	if bytes.HasSuffix(str, []byte("--")) {
-		err = io.EOF
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	if err == io.EOF && !found {
+		err = fmt.Errorf("%w: missing closing delimiter %s--", ErrUnterminatedPart, boundary)
+	} else {
+		err = nil
+	}
+	if group >= 0 {
+		raw := r.tee
+		if found {
+			raw = raw[:len(raw)-len(line)]
+		}
+		part.raw = trimLineEnding(raw)
+		r.teeing = false
+		r.groups[group].parts = append(r.groups[group].parts, part)
 	}
-	ps, err1 := part2Parts(part, parent)
+	ps, err1 := r.part2Parts(part, boundary)
 	if err1 != nil {
-		return nil, err1
+		return ps, false, err1
+	}
+	return ps, last, err
+}
+
+// trimLineEnding removes the line ending preceding a boundary delimiter, which
+// belongs to the delimiter rather than to the part.
+func trimLineEnding(bs []byte) []byte {
+	if bytes.HasSuffix(bs, []byte("\r\n")) {
+		return bs[:len(bs)-2]
+	}
+	return bytes.TrimSuffix(bs, []byte("\n"))
+}
+
+func intactKind(mt mediaType) string {
+	if !strings.EqualFold(mt.MainType, multiPart) {
+		return ""
+	}
+	switch sub := strings.ToLower(mt.SubType); sub {
+	case multiSign, multiCrypt:
+		return sub
+	default:
+		return ""
+	}
+}
+
+// checkBoundary reports an error when the boundary of the container p can not
+// be told apart from one of the boundaries enclosing it: its delimiters would
+// close the enclosing parts.
+func (r *reader) checkBoundary(p Part) error {
+	child := "--" + p.Boundary()
+	for _, b := range r.boundaries {
+		switch parent := string(b); {
+		case child == parent, child+"--" == parent, child == parent+"--":
+			return fmt.Errorf("%w: %s in part %s", ErrBoundaryConflict, p.Boundary(), p.path)
+		}
+	}
+	return nil
+}
+
+func matchBoundary(line, boundary []byte) (bool, bool) {
+	line = bytes.TrimRight(line, " \t\r\n")
+	if !bytes.HasPrefix(line, boundary) {
+		return false, false
+	}
+	switch rest := line[len(boundary):]; {
+	case len(rest) == 0:
+		return true, false
+	case bytes.Equal(rest, []byte("--")):
+		return true, true
+	default:
+		return false, false
 	}
-	return ps, err
 }
 
-func part2Parts(p Part, parent []byte) ([]Part, error) {
+func (r *reader) part2Parts(p Part, parent []byte) ([]Part, error) {
 	if !p.IsMultipart() {
 		return []Part{p}, nil
 	}
-	mt, err := mime.Parse(p.Get(hdrContentType))
+	mt, err := p.mediaType()
 	if err != nil {
 		return nil, err
 	}
-	r := bufio.NewReader(bytes.NewReader(p.Body))
-	return readBody(r, []byte("--"+mt.Params[multiBound]), parent)
+	r.containers = append(r.containers, p)
+	rs := bufio.NewReader(bytes.NewReader(p.containerBody()))
+	return r.readBody(rs, []byte("--"+mt.Params[multiBound]), parent, intactKind(mt))
 }
 
-func skipEpilog(rs *bufio.Reader, boundary []byte) error {
+func (r *reader) skipEpilog(rs *bufio.Reader, boundary []byte, top bool) error {
+	done := func() bool {
+		chunk, _ := rs.Peek(len(boundary))
+		return bytes.Equal(chunk, boundary)
+	}
 	if boundary == nil {
-		boundary = []byte(fromLinePrefix)
+		done = func() bool {
+			return r.atSeparator(rs)
+		}
 	}
-	size := len(boundary)
 	for {
-		chunk, err := rs.Peek(size)
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		if done() {
+			break
+		}
+		line, err := rs.ReadBytes('\n')
+		r.record(rs, line)
+		if top && r.keepPreamble {
+			r.epilog = append(r.epilog, line...)
+		}
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
 			return err
 		}
-		if bytes.Equal(chunk, boundary) {
+	}
+	if top && boundary == nil {
+		r.epilog = trimSeparator(r.epilog)
+	}
+	return nil
+}
+
+// trimSeparator removes the blank line separating a message from the next
+// one in the mailbox.
+func trimSeparator(bs []byte) []byte {
+	switch {
+	case bytes.Equal(bs, []byte("\n")) || bytes.Equal(bs, []byte("\r\n")):
+		return bs[:0]
+	case bytes.HasSuffix(bs, []byte("\r\n\r\n")):
+		return bs[:len(bs)-2]
+	case bytes.HasSuffix(bs, []byte("\n\n")):
+		return bs[:len(bs)-1]
+	default:
+		return bs
+	}
+}
+
+func (r *reader) skipProlog(rs *bufio.Reader, boundary []byte, top bool) error {
+	for {
+		if top && r.atSeparator(rs) {
+			return fmt.Errorf("%w: missing opening delimiter %s", ErrBoundaryMismatch, boundary)
+		}
+		line, err := r.readLine(rs)
+		if err == io.EOF && len(line) == 0 {
+			return fmt.Errorf("%w: missing opening delimiter %s", ErrBoundaryMismatch, boundary)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if ok, _ := matchBoundary(line, boundary); ok {
 			break
 		}
-		rs.ReadBytes('\n')
+		if top && r.keepPreamble {
+			r.preamble = append(r.preamble, line...)
+		}
 	}
 	return nil
 }
 
-func skipProlog(rs *bufio.Reader, boundary []byte) error {
-	for {
-		line, err := rs.ReadBytes('\n')
+func (r *reader) readPlain(rs *bufio.Reader, m *Message) error {
+	part := Part{path: "1", charset: r.charset, gunzip: r.gunzip, parser: r.parser}
+	n, ok := m.ContentLength()
+	if !ok && m.Has(hdrContentLength) && !r.lenient {
+		return fmt.Errorf("%w: %s", ErrInvalidLength, m.Get(hdrContentLength))
+	}
+	if ok {
+		done, err := r.readLength(rs, &part, n)
 		if err != nil {
 			return err
 		}
-		if line = bytes.TrimSpace(line); bytes.Equal(line, boundary) {
-			break
+		if done {
+			m.Parts = append(m.Parts, part)
+			m.Partial = r.partial
+			return nil
 		}
+	} else {
+		part.Body = make([]byte, 0, 32<<10)
 	}
+	if err := r.scanPlain(rs, &part); err != nil {
+		return err
+	}
+	m.Parts = append(m.Parts, part)
+	m.Partial = r.partial
 	return nil
 }
 
-func readPlain(rs *bufio.Reader, m *Message) error {
-	var (
-		buffer = make([]byte, 0, 32<<10)
-		delim  = []byte(fromLinePrefix)
-		size   = len(delim)
-	)
+func (r *reader) readLength(rs *bufio.Reader, p *Part, n int) (bool, error) {
+	if err := r.ctx.Err(); err != nil {
+		return false, err
+	}
+	if n < 0 {
+		return false, fmt.Errorf("%w: %d", ErrInvalidLength, n)
+	}
+	keep := n
+	if r.maxPartSize > 0 && keep > r.maxPartSize {
+		keep = r.maxPartSize
+	}
+	// the body is grown as it is read: the length given by the header can not
+	// be trusted to allocate it.
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, rs, int64(keep))
+	r.record(rs, buf.Bytes())
+	if err == nil && keep < n {
+		p.truncated, r.partial = true, true
+		err = r.discard(rs, n-keep)
+	}
+	p.Body = buf.Bytes()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	var skip []byte
+	for {
+		if r.atSeparator(rs) {
+			return true, nil
+		}
+		chunk, err := rs.Peek(len(fromLinePrefix))
+		if err == io.EOF && len(chunk) == 0 {
+			return true, nil
+		}
+		n := blankLine(chunk)
+		if n == 0 {
+			r.accumulate(p, skip)
+			return false, nil
+		}
+		skip = append(skip, chunk[:n]...)
+		r.record(rs, chunk[:n])
+		rs.Discard(n)
+	}
+}
+
+func (r *reader) discard(rs *bufio.Reader, n int) error {
+	buf := make([]byte, 32<<10)
+	for n > 0 {
+		if n < len(buf) {
+			buf = buf[:n]
+		}
+		c, err := io.ReadFull(rs, buf)
+		r.record(rs, buf[:c])
+		if err != nil {
+			return err
+		}
+		n -= c
+	}
+	return nil
+}
+
+// accumulate appends bs to the body of p as long as the size of the body stays
+// under the limit set with MaxPartSize.
+func (r *reader) accumulate(p *Part, bs []byte) {
+	if r.maxPartSize > 0 && len(p.Body)+len(bs) > r.maxPartSize {
+		bs = bs[:r.maxPartSize-len(p.Body)]
+		p.truncated, r.partial = true, true
+	}
+	p.Body = append(p.Body, bs...)
+}
+
+func blankLine(chunk []byte) int {
+	switch {
+	case bytes.HasPrefix(chunk, []byte("\n")):
+		return 1
+	case bytes.HasPrefix(chunk, []byte("\r\n")):
+		return 2
+	default:
+		return 0
+	}
+}
+
+func (r *reader) scanPlain(rs *bufio.Reader, p *Part) error {
 	for {
-		if chunk, _ := rs.Peek(size); bytes.Equal(chunk, delim) {
+		if r.atSeparator(rs) {
 			break
 		}
-		bs, err := rs.ReadBytes('\n')
+		bs, err := r.readLine(rs)
 		if len(bs) > 0 {
-			buffer = append(buffer, bs...)
+			r.accumulate(p, bs)
 		}
 		if err != nil {
 			if err == io.EOF {
@@ -435,80 +1721,262 @@ func readPlain(rs *bufio.Reader, m *Message) error {
 			return err
 		}
 	}
-	m.Parts = append(m.Parts, Part{Body: buffer})
+	if p.truncated {
+		return nil
+	}
+	if bytes.HasSuffix(p.Body, []byte("\r\n\r\n")) {
+		p.Body = p.Body[:len(p.Body)-2]
+	} else if bytes.HasSuffix(p.Body, []byte("\n\n")) {
+		p.Body = p.Body[:len(p.Body)-1]
+	}
 	return nil
 }
 
-func readHeader(rs *bufio.Reader) (Header, error) {
-	hdr := make(Header)
+func (r *reader) readHeader(rs *bufio.Reader) (Header, []string, int, error) {
+	var (
+		hdr  = make(Header)
+		keys []string
+		last string
+		size int
+	)
 	for {
-		line, err := rs.ReadString('\n')
+		str, err := r.readLine(rs)
+		size += len(str)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			return nil, nil, 0, err
 		}
-		line = strings.TrimSpace(line)
+		line := strings.TrimSpace(string(str))
 		if len(line) == 0 {
-			break
+			if _, ok := traceHeaders[last]; !ok || !continuedHeader(rs) {
+				break
+			}
+			// obsolete folding: the blank line is followed by the
+			// continuation of the previous field.
+			vs := hdr[last]
+			value, n := r.readFolding(rs, last, vs[len(vs)-1])
+			vs[len(vs)-1], size = value, size+n
+			continue
 		}
 		ix := strings.Index(line, ":")
 		if ix < 0 {
-			return nil, fmt.Errorf("missing colon in header: %s", line)
+			return nil, nil, 0, fmt.Errorf("missing colon in header: %s", line)
 		}
 		field, value := line[:ix], strings.TrimSpace(line[ix+1:])
-		for {
-			if next, _ := rs.ReadByte(); next == '\t' || next == ' ' {
-				str, _ := rs.ReadString('\n')
-				if next == ' ' {
-					str = strings.TrimSpace(str)
-				}
-				value += " " + str
-			} else {
-				rs.UnreadByte()
-				break
-			}
+		value, n := r.readFolding(rs, field, value)
+		size += n
+
+		last = textproto.CanonicalMIMEHeaderKey(field)
+		if !hdr.Has(last) {
+			keys = append(keys, last)
 		}
 		hdr.Add(field, value)
 	}
-	return hdr, nil
+	return hdr, keys, size, nil
+}
+
+func (r *reader) readFolding(rs *bufio.Reader, field, value string) (string, int) {
+	var size int
+	for {
+		if next, _ := rs.ReadByte(); next == '\t' || next == ' ' {
+			rs.UnreadByte()
+			str, _ := rs.ReadString('\n')
+			r.record(rs, []byte(str))
+			size += len(str)
+			value = unfold(field, value, strings.TrimRight(str, "\r\n"))
+		} else {
+			rs.UnreadByte()
+			break
+		}
+	}
+	return strings.TrimSpace(value), size
+}
+
+// continuedHeader reports whether the lines following a blank line in a header
+// are the continuation of the previous field, as allowed by the obsolete syntax
+// of RFC 5322, rather than the start of the body. It is the case when they
+// start with whitespace and are followed by the fields of the rest of the
+// header, up to a blank line.
+func continuedHeader(rs *bufio.Reader) bool {
+	if next, _ := rs.Peek(1); len(next) == 0 || (next[0] != ' ' && next[0] != '\t') {
+		return false
+	}
+	var (
+		buf, _ = rs.Peek(rs.Size())
+		fields int
+	)
+	for {
+		ix := bytes.IndexByte(buf, '\n')
+		if ix < 0 {
+			return false
+		}
+		line := buf[:ix+1]
+		buf = buf[ix+1:]
+		switch {
+		case len(bytes.TrimSpace(line)) == 0:
+			return fields > 0
+		case line[0] == ' ' || line[0] == '\t':
+		case isHeaderField(line):
+			fields++
+		default:
+			return false
+		}
+	}
+}
+
+func isHeaderField(line []byte) bool {
+	ix := bytes.IndexByte(line, ':')
+	if ix <= 0 {
+		return false
+	}
+	for _, b := range line[:ix] {
+		if b <= ' ' || b > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func unfold(field, value, next string) string {
+	switch textproto.CanonicalMIMEHeaderKey(field) {
+	case hdrMessageID, hdrInReplyTo, hdrReferences:
+		if strings.Count(value, "<") > strings.Count(value, ">") {
+			next = strings.TrimLeft(next, " \t")
+		}
+	}
+	return value + next
 }
 
 var timePattern = []string{
 	"Mon, _2 Jan 2006 15:04:05 -0700",
 	"Mon, _2 Jan 2006 15:04:05 -0700 (MST)",
+	"Mon, _2 Jan 2006 15:04:05 MST",
+	"Mon, _2 Jan 2006 15:04 -0700",
+	"_2 Jan 2006 15:04:05 -0700",
+	"_2 Jan 2006 15:04:05 -0700 (MST)",
+	"_2 Jan 2006 15:04:05 MST",
+	"_2 Jan 2006 15:04 -0700",
 }
 
-func parseTime(str string) time.Time {
+func parseDate(str string) (time.Time, error) {
 	var (
 		when time.Time
 		err  error
 	)
+	str = strings.Join(strings.Fields(str), " ")
 	for _, p := range timePattern {
 		when, err = time.Parse(p, str)
 		if err == nil {
 			break
 		}
 	}
-	return when
+	return when, err
 }
 
 func parseValueField(str string) (string, map[string]string) {
+	value, ps, _ := parseExtendedField(str)
+	return value, ps
+}
+
+// parseExtendedField parses str like parseValueField but also reassembles the
+// parameters continued over several segments and decodes the parameters
+// encoded as defined by RFC 2231. The charsets declared by the encoded
+// parameters are returned in a separate map.
+func parseExtendedField(str string) (string, map[string]string, map[string]string) {
 	parts := strings.Split(str, ";")
 	if len(parts) == 1 {
-		return parts[0], nil
+		return parts[0], nil, nil
 	}
-	ps := make(map[string]string)
+	var (
+		ps       = make(map[string]string)
+		charsets = make(map[string]string)
+		segments = make(map[string][]paramSegment)
+	)
 	for _, str := range parts[1:] {
-		var (
-			vs  = strings.Split(strings.TrimSpace(str), "=")
-			key = strings.ToLower(vs[0])
-			val = strings.Trim(vs[1], "\" ")
-		)
-		ps[strings.TrimSpace(key)] = val
-	}
-	return parts[0], ps
+		key, val, _ := strings.Cut(strings.TrimSpace(str), "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.Trim(val, "\" ")
+		seg, ok := parseParamKey(key, val)
+		if !ok {
+			ps[key] = val
+			continue
+		}
+		segments[seg.name] = append(segments[seg.name], seg)
+	}
+	for name, list := range segments {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].index < list[j].index
+		})
+		value, charset := joinSegments(list)
+		ps[name] = value
+		if charset != "" {
+			charsets[name] = charset
+		}
+	}
+	return parts[0], ps, charsets
+}
+
+type paramSegment struct {
+	name    string
+	index   int
+	encoded bool
+	value   string
+}
+
+// parseParamKey splits the keys of RFC 2231 parameters (name*, name*0,
+// name*1*...) into their name, the index of the segment and whether the
+// segment is percent-encoded.
+func parseParamKey(key, value string) (paramSegment, bool) {
+	name, rest, ok := strings.Cut(key, "*")
+	if !ok || name == "" {
+		return paramSegment{}, false
+	}
+	seg := paramSegment{
+		name:    name,
+		encoded: rest == "" || strings.HasSuffix(rest, "*"),
+		value:   value,
+	}
+	if rest = strings.TrimSuffix(rest, "*"); rest != "" {
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return paramSegment{}, false
+		}
+		seg.index = n
+	}
+	return seg, true
+}
+
+func joinSegments(list []paramSegment) (string, string) {
+	var (
+		buf     []byte
+		charset string
+	)
+	for _, seg := range list {
+		value := seg.value
+		if !seg.encoded {
+			buf = append(buf, value...)
+			continue
+		}
+		if seg.index == 0 {
+			if cs, rest, ok := strings.Cut(value, "'"); ok {
+				if _, rest, ok = strings.Cut(rest, "'"); ok {
+					charset, value = strings.ToLower(cs), rest
+				}
+			}
+		}
+		if str, err := url.PathUnescape(value); err == nil {
+			value = str
+		}
+		buf = append(buf, value...)
+	}
+	if charset != "" {
+		if dec, err := decodeCharset(charset, buf); err == nil {
+			buf = dec
+		}
+	}
+	return string(buf), charset
 }
 
 func parseAddress(str string) string {
@@ -2,10 +2,16 @@ package mbox
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -98,3 +104,1306 @@ func testReadMessage(tc TestCase) error {
 	}
 	return nil
 }
+
+func TestSniffedType(t *testing.T) {
+	m, err := openMessage("octet.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(m.Parts) != 2 {
+		t.Fatalf("wrong number of part! want %d, got %d", 2, len(m.Parts))
+	}
+	p := m.Parts[1]
+	if got := p.DeclaredType(); got != "application/octet-stream" {
+		t.Errorf("wrong declared type! want %s, got %s", "application/octet-stream", got)
+	}
+	if got := p.SniffedType(); got != "application/pdf" {
+		t.Errorf("wrong sniffed type! want %s, got %s", "application/pdf", got)
+	}
+	if got := m.Parts[0].SniffedType(); got != "text/plain" {
+		t.Errorf("wrong sniffed type! want %s, got %s", "text/plain", got)
+	}
+}
+
+func openMessage(file string) (Message, error) {
+	r, err := os.Open(filepath.Join("testdata", file))
+	if err != nil {
+		return Message{}, err
+	}
+	defer r.Close()
+	return ReadMessage(bufio.NewReader(r))
+}
+
+func TestObsoleteFolding(t *testing.T) {
+	m, err := openMessage("obsolete-folding.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if got := m.Get("Received"); !strings.HasPrefix(got, "from mail.foobar.org") || !strings.HasSuffix(got, "+0200") {
+		t.Errorf("received header not unfolded: %q", got)
+	}
+	if got := m.Subject(); got != defaultSubject {
+		t.Errorf("wrong subject! want %s, got %s", defaultSubject, got)
+	}
+	if got := m.MessageID(); got != "1234@local.foobar.org" {
+		t.Errorf("wrong message id! want %s, got %s", "1234@local.foobar.org", got)
+	}
+	if len(m.Parts) != 1 {
+		t.Fatalf("wrong number of parts! want 1, got %d", len(m.Parts))
+	}
+	if body := string(m.Parts[0].Body); !strings.HasPrefix(body, "  this body") {
+		t.Errorf("body should start with whitespace: %q", body)
+	}
+}
+
+func TestIndentedBody(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "indented-body.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	scan := NewScanner(r)
+	var n int
+	for ; scan.Scan(); n++ {
+		m := scan.Message()
+		if got := m.Subject(); got != defaultSubject {
+			t.Errorf("%d: wrong subject! want %s, got %s", n, defaultSubject, got)
+		}
+		if len(m.Parts) != 1 {
+			t.Errorf("%d: wrong number of parts! want 1, got %d", n, len(m.Parts))
+			continue
+		}
+		if body := string(m.Parts[0].Body); !strings.HasPrefix(body, "    $ make install\nNote: run as root\nbye") {
+			t.Errorf("%d: wrong body: %q", n, body)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("wrong number of messages! want 2, got %d", n)
+	}
+}
+
+func TestTextBody(t *testing.T) {
+	data := []struct {
+		File string
+		Want string
+	}{
+		{
+			File: "simple.txt",
+			Want: "This is a message to be parsed by the library.\nSo, \"good luck\".\n",
+		},
+		{
+			File: "alternative.txt",
+			Want: "This is a message to be parsed by the library.\nSo, \"good luck\".\n\n",
+		},
+		{
+			File: "html.txt",
+			Want: "This is a message to be parsed by the library.\n\nSo, \"good luck\".\n\nCafé crème.",
+		},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", d.File, err)
+			continue
+		}
+		if got := m.TextBody(); got != d.Want {
+			t.Errorf("%s: wrong text body! want %q, got %q", d.File, d.Want, got)
+		}
+	}
+}
+
+func TestFilterErr(t *testing.T) {
+	m, err := openMessage("mixedalt.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	var (
+		errStop = errors.New("stop")
+		calls   int
+	)
+	ps, err := m.FilterErr(func(p Part) (bool, error) {
+		calls++
+		if calls == 2 {
+			return false, errStop
+		}
+		return true, nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("unexpected error! want %s, got %v", errStop, err)
+	}
+	if calls != 2 {
+		t.Errorf("predicate should stop at first error! want %d calls, got %d", 2, calls)
+	}
+	if len(ps) != 1 {
+		t.Errorf("wrong number of part! want %d, got %d", 1, len(ps))
+	}
+
+	ps, err = m.FilterErr(func(p Part) (bool, error) {
+		return p.IsAttachment(), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(ps) != 1 {
+		t.Errorf("wrong number of part! want %d, got %d", 1, len(ps))
+	}
+}
+
+func TestDate(t *testing.T) {
+	data := []struct {
+		File string
+		Want time.Time
+	}{
+		{
+			File: "simple.txt",
+			Want: time.Date(2020, 1, 22, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			File: "date-nocomma.txt",
+			Want: time.Date(2020, 1, 2, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			File: "date-spaces.txt",
+			Want: time.Date(2020, 1, 22, 9, 15, 0, 0, time.UTC),
+		},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", d.File, err)
+			continue
+		}
+		if got := m.Date(); !got.Equal(d.Want) {
+			t.Errorf("%s: wrong date! want %s, got %s", d.File, d.Want, got)
+		}
+	}
+}
+
+func TestHeaderConstants(t *testing.T) {
+	keys := []string{
+		hdrMimeVersion,
+		hdrContentType,
+		hdrContentLength,
+		hdrContentDispo,
+		hdrContentEncoding,
+		hdrContentCoding,
+		hdrContentLanguage,
+		hdrContentID,
+		hdrDate,
+		hdrFrom,
+		hdrSender,
+		hdrReplyTo,
+		hdrTo,
+		hdrCc,
+		hdrBcc,
+		hdrSubject,
+		hdrMessageID,
+		hdrInReplyTo,
+		hdrReferences,
+		hdrAutoSubmitted,
+		hdrAutoReply,
+		hdrAutoRespond,
+		hdrPrecedence,
+		hdrAuthResults,
+	}
+	for _, k := range keys {
+		if got := textproto.CanonicalMIMEHeaderKey(k); got != k {
+			t.Errorf("header key not canonical! want %s, got %s", got, k)
+		}
+	}
+}
+
+func TestHeaderAccessors(t *testing.T) {
+	hdr := make(Header)
+	hdr.Add("resent-date", "2 Jan 2020 11:15:00 +0200")
+	hdr.Add("resent-to", "rustine <rustine@foobar.org>, =?utf-8?q?J=C3=A9r=C3=B4me?= <jerome@foobar.org>, midbel@foobar.org")
+
+	when, err := hdr.Date("resent-date")
+	if err != nil {
+		t.Fatalf("fail to parse date: %s", err)
+	}
+	if want := time.Date(2020, 1, 2, 9, 15, 0, 0, time.UTC); !when.Equal(want) {
+		t.Errorf("wrong date! want %s, got %s", want, when)
+	}
+	as, err := hdr.AddressList("resent-to")
+	if err != nil {
+		t.Fatalf("fail to parse addresses: %s", err)
+	}
+	want := []Address{
+		{Name: "rustine", Addr: "rustine@foobar.org"},
+		{Name: "Jérôme", Addr: "jerome@foobar.org"},
+		{Addr: "midbel@foobar.org"},
+	}
+	if len(as) != len(want) {
+		t.Fatalf("wrong number of addresses! want %d, got %d", len(want), len(as))
+	}
+	for i := range want {
+		if as[i] != want[i] {
+			t.Errorf("wrong address! want %v, got %v", want[i], as[i])
+		}
+	}
+	if _, err := hdr.Date("date"); err == nil {
+		t.Errorf("missing header should return an error")
+	}
+	if _, err := hdr.AddressList("cc"); err == nil {
+		t.Errorf("missing header should return an error")
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "mboxcl.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	var (
+		rs   = bufio.NewReader(r)
+		want = "This message carries an unescaped separator.\nFrom here on, the body goes on.\n"
+	)
+	m, err := ReadMessage(rs)
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if n, ok := m.ContentLength(); !ok || n != len(want) {
+		t.Errorf("wrong content length! want %d, got %d", len(want), n)
+	}
+	if got := m.TextBody(); got != want {
+		t.Errorf("wrong body! want %q, got %q", want, got)
+	}
+	m, err = ReadMessage(rs)
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if _, ok := m.ContentLength(); ok {
+		t.Errorf("message should not have a content length")
+	}
+	if got := m.Get("message-id"); got != "<1234@local.foobar.org>" {
+		t.Errorf("wrong message! want %s, got %s", "<1234@local.foobar.org>", got)
+	}
+}
+
+func TestInvalidContentLength(t *testing.T) {
+	const body = "short body\n"
+	data := []struct {
+		Length  string
+		Lenient bool
+		Err     error
+	}{
+		{Length: "9223372036854775807"},
+		{Length: "4096"},
+		{Length: "99999999999999999999", Err: ErrInvalidLength},
+		{Length: "-1", Err: ErrInvalidLength},
+		{Length: "abc", Err: ErrInvalidLength},
+		{Length: "-1", Lenient: true},
+	}
+	for _, d := range data {
+		str := "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+			"From: midbel <midbel@foobar.org>\n" +
+			"Subject: mbox test\n" +
+			"Content-Length: " + d.Length + "\n" +
+			"\n" +
+			body
+		var opts []Option
+		if d.Lenient {
+			opts = append(opts, Lenient())
+		}
+		m, err := ReadMessage(bufio.NewReader(strings.NewReader(str)), opts...)
+		if d.Err != nil {
+			if !errors.Is(err, d.Err) {
+				t.Errorf("%s: wrong error! want %s, got %v", d.Length, d.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", d.Length, err)
+			continue
+		}
+		if got := m.TextBody(); got != body {
+			t.Errorf("%s: wrong body! want %q, got %q", d.Length, body, got)
+		}
+	}
+}
+
+func TestReadReceiptTo(t *testing.T) {
+	data := []struct {
+		File string
+		Drop string
+		Want string
+	}{
+		{File: "receipt.txt", Want: "receipts@foobar.org"},
+		{File: "receipt.txt", Drop: "disposition-notification-to", Want: "midbel@foobar.org"},
+		{File: "simple.txt"},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if d.Drop != "" {
+			m.Del(d.Drop)
+		}
+		if got := m.ReadReceiptTo(); got != d.Want {
+			t.Errorf("%s: receipt address mismatched! want %q, got %q", d.File, d.Want, got)
+		}
+		if got := m.IsReadReceiptRequested(); got != (d.Want != "") {
+			t.Errorf("%s: receipt request mismatched! want %t, got %t", d.File, d.Want != "", got)
+		}
+	}
+}
+
+func TestSenderReplyTo(t *testing.T) {
+	m, err := openMessage("replyto.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	sender := Address{Name: "golang list", Addr: "list-bounces@lists.foobar.org"}
+	if got := m.Sender(); got != sender {
+		t.Errorf("sender mismatched! want %v, got %v", sender, got)
+	}
+	want := []Address{
+		{Name: "Golang € list", Addr: "golang@lists.foobar.org"},
+		{Name: "Jérôme", Addr: "jerome@foobar.org"},
+	}
+	got := m.ReplyTo()
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of addresses! want %d, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reply-to mismatched! want %v, got %v", want[i], got[i])
+		}
+	}
+
+	m, err = openMessage("simple.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if got := m.Sender(); got.Addr != defaultFrom {
+		t.Errorf("sender mismatched! want %s, got %s", defaultFrom, got.Addr)
+	}
+	if got := m.ReplyTo(); len(got) != 0 {
+		t.Errorf("unexpected reply-to: %v", got)
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	m, err := openMessage("recipients.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if got := m.Bcc(); len(got) != 2 || got[0] != "bob@foobar.org" || got[1] != "jerome@foobar.org" {
+		t.Errorf("wrong bcc recipients: %q", got)
+	}
+	if got := m.Cc(); len(got) != 2 || got[0] != "Rustine@FooBar.org" || got[1] != "alice@foobar.org" {
+		t.Errorf("wrong cc recipients: %q", got)
+	}
+	var (
+		want = []string{"rustine@foobar.org", "jerome@foobar.org", "alice@foobar.org", "bob@foobar.org"}
+		got  = m.Recipients()
+	)
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of recipients! want %d, got %d (%q)", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("wrong recipient! want %s, got %s", want[i], got[i])
+		}
+	}
+}
+
+func TestFilenames(t *testing.T) {
+	m, err := openMessage("filenames.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(m.Parts) != 2 {
+		t.Fatalf("wrong number of part! want %d, got %d", 2, len(m.Parts))
+	}
+	p := m.Parts[1]
+	dispo, name := p.Filenames()
+	if dispo != "a.txt" {
+		t.Errorf("wrong disposition filename! want %s, got %s", "a.txt", dispo)
+	}
+	if name != "b.pdf" {
+		t.Errorf("wrong content type name! want %s, got %s", "b.pdf", name)
+	}
+	if got := p.Filename(); got != dispo {
+		t.Errorf("disposition filename should take precedence! want %s, got %s", dispo, got)
+	}
+	dispo, name = m.Parts[0].Filenames()
+	if dispo != "" || name != "" {
+		t.Errorf("unexpected filenames for text part: %q, %q", dispo, name)
+	}
+}
+
+func TestFilenameCharset(t *testing.T) {
+	m, err := openMessage("filename-charsets.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []string{"", "", "utf-8", "iso-8859-1", "windows-1252", "koi8-r"}
+	if len(m.Parts) != len(want) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(want), len(m.Parts))
+	}
+	for i, p := range m.Parts {
+		if got := p.FilenameCharset(); got != want[i] {
+			t.Errorf("%s: charset mismatched! want %q, got %q", p.Path(), want[i], got)
+		}
+	}
+	names := []string{"", "plain.txt", "€.pdf", "café.txt", "naïf.txt", "=?koi8-r?B?8NLJ18XU?=.txt"}
+	for i, p := range m.Parts {
+		if got := p.Filename(); got != names[i] {
+			t.Errorf("%s: filename mismatched! want %s, got %s", p.Path(), names[i], got)
+		}
+	}
+}
+
+func TestFilenameContinuation(t *testing.T) {
+	m, err := openMessage("filename-continuation.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []struct {
+		Name    string
+		Charset string
+	}{
+		{},
+		{Name: "Rapport annuel € 2020 final.pdf", Charset: "utf-8"},
+		{Name: "résumé 2020.txt", Charset: "iso-8859-1"},
+		{Name: "naïf.txt", Charset: "utf-8"},
+	}
+	if len(m.Parts) != len(want) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(want), len(m.Parts))
+	}
+	for i, p := range m.Parts {
+		if got := p.Filename(); got != want[i].Name {
+			t.Errorf("%s: filename mismatched! want %q, got %q", p.Path(), want[i].Name, got)
+		}
+		if got := p.FilenameCharset(); got != want[i].Charset {
+			t.Errorf("%s: charset mismatched! want %q, got %q", p.Path(), want[i].Charset, got)
+		}
+	}
+}
+
+func TestUnfoldHeader(t *testing.T) {
+	const msg = `From midbel@foobar.org Wed Jan 22 11:15:00 2020
+From: midbel <midbel@foobar.org>
+Subject: mbox
+ test
+References: <1234@local.foobar.org> <5678@local.
+ foobar.org>
+	<4567@local.foobar.org>
+Received: from foobar.org
+	by local.foobar.org;
+	Wed, 22 Jan 2020 11:15:00 +0200
+
+This is a message to be parsed by the library.
+`
+	m, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)))
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	data := []struct {
+		Field string
+		Want  string
+	}{
+		{
+			Field: "subject",
+			Want:  "mbox test",
+		},
+		{
+			Field: "references",
+			Want:  "<1234@local.foobar.org> <5678@local.foobar.org>\t<4567@local.foobar.org>",
+		},
+		{
+			Field: "received",
+			Want:  "from foobar.org\tby local.foobar.org;\tWed, 22 Jan 2020 11:15:00 +0200",
+		},
+	}
+	for _, d := range data {
+		if got := m.Get(d.Field); got != d.Want {
+			t.Errorf("%s: wrong value! want %q, got %q", d.Field, d.Want, got)
+		}
+	}
+}
+
+func TestDecodeEncodingVariants(t *testing.T) {
+	data := []struct {
+		Encoding string
+		Body     string
+		Want     string
+	}{
+		{Encoding: "base64", Body: "aGVsbG8gd29ybGQ=\n", Want: "hello world"},
+		{Encoding: "Base64 ", Body: "aGVsbG8gd29ybGQ=\n", Want: "hello world"},
+		{Encoding: "BASE64 (encoded by foomail)", Body: "aGVsbG8gd29ybGQ=\n", Want: "hello world"},
+		{Encoding: "base64", Body: "aGVs bG8g\td29y\r\nbGQ=\n", Want: "hello world"},
+		{Encoding: "base64", Body: "aGVsbG8=\nIHdvcmxk\n", Want: "hello world"},
+		{Encoding: "base64", Body: "aGVsbA==bw==IHdvcmxk", Want: "hello world"},
+		{Encoding: "(legacy) Quoted-Printable", Body: "hello=20world", Want: "hello world"},
+		{Encoding: "x-unknown", Body: "aGVsbG8gd29ybGQ=\n", Want: "aGVsbG8gd29ybGQ=\n"},
+	}
+	for _, d := range data {
+		p := Part{
+			Header: make(Header),
+			Body:   []byte(d.Body),
+		}
+		p.Set("content-transfer-encoding", d.Encoding)
+		if got := string(p.Bytes()); got != d.Want {
+			t.Errorf("%s: wrong decoded body! want %q, got %q", d.Encoding, d.Want, got)
+		}
+	}
+}
+
+func TestDecodedBody(t *testing.T) {
+	m, err := openMessage("badbase64.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(m.Parts) != 2 {
+		t.Fatalf("wrong number of part! want %d, got %d", 2, len(m.Parts))
+	}
+	if _, err := m.Parts[0].DecodedBody(); err != nil {
+		t.Errorf("unexpected error decoding text part: %s", err)
+	}
+	p := m.Parts[1]
+	body, err := p.DecodedBody()
+	if err == nil {
+		t.Fatalf("decoding invalid base64 should fail")
+	}
+	if !bytes.Equal(body, p.Bytes()) {
+		t.Errorf("lossy and strict decoding should yield the same bytes")
+	}
+	if len(body) == 0 || !bytes.HasPrefix(body, []byte("%PDF-1.4")) {
+		t.Errorf("valid prefix should be decoded: %q", body)
+	}
+}
+
+func TestPartWriteTo(t *testing.T) {
+	for _, f := range []string{"mixed.txt", "encoded.txt", "badbase64.txt", "mislabeled-7bit.txt"} {
+		m, err := openMessage(f)
+		if err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", f, err)
+		}
+		for _, p := range m.Parts {
+			var (
+				buf       bytes.Buffer
+				n, err    = p.WriteTo(&buf)
+				want, bad = p.DecodedBody()
+			)
+			if (err == nil) != (bad == nil) {
+				t.Errorf("%s/%s: errors mismatched! want %v, got %v", f, p.Path(), bad, err)
+			}
+			if n != int64(buf.Len()) {
+				t.Errorf("%s/%s: wrong number of bytes written! want %d, got %d", f, p.Path(), buf.Len(), n)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s/%s: body mismatched! want %q, got %q", f, p.Path(), want, buf.Bytes())
+			}
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	m, err := openMessage("mislabeled-7bit.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []struct {
+		Encoding string
+		Err      error
+	}{
+		{Encoding: "7bit"},
+		{Encoding: "7bit", Err: ErrNot7bit},
+		{Encoding: "8bit"},
+		{Encoding: "7bit"},
+	}
+	if len(m.Parts) != len(want) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(want), len(m.Parts))
+	}
+	for i, p := range m.Parts {
+		if got := p.Encoding(); got != want[i].Encoding {
+			t.Errorf("%s: wrong encoding! want %s, got %s", p.Path(), want[i].Encoding, got)
+		}
+		body, err := p.DecodedBody()
+		if !errors.Is(err, want[i].Err) {
+			t.Errorf("%s: wrong error! want %v, got %v", p.Path(), want[i].Err, err)
+		}
+		if !bytes.Equal(body, p.Body) {
+			t.Errorf("%s: body should be kept as is", p.Path())
+		}
+	}
+	report := m.QualityReport()
+	if len(report) != 1 || report[0].Path != "2" || report[0].Problem != IssueInvalidEncoding {
+		t.Errorf("mislabeled part should be reported: %v", report)
+	}
+}
+
+func TestWalkParts(t *testing.T) {
+	m, err := openMessage("mixedalt.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []struct {
+		Path  string
+		Depth int
+		Type  string
+	}{
+		{Path: "1", Depth: 0, Type: "multipart/alternative"},
+		{Path: "1.1", Depth: 1, Type: "text/plain"},
+		{Path: "1.2", Depth: 1, Type: "text/html"},
+		{Path: "2", Depth: 0, Type: "text/html"},
+	}
+	var i int
+	m.WalkParts(func(p Part, depth int) error {
+		if i >= len(want) {
+			t.Fatalf("too many parts visited")
+		}
+		w := want[i]
+		if p.Path() != w.Path || depth != w.Depth || p.DeclaredType() != w.Type {
+			t.Errorf("wrong part! want %s/%d/%s, got %s/%d/%s", w.Path, w.Depth, w.Type, p.Path(), depth, p.DeclaredType())
+		}
+		i++
+		return nil
+	})
+	if i != len(want) {
+		t.Errorf("wrong number of parts visited! want %d, got %d", len(want), i)
+	}
+}
+
+func TestEmptyPreamble(t *testing.T) {
+	m, err := openMessage("noprolog.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(m.Parts) != 2 {
+		t.Fatalf("wrong number of part! want %d, got %d", 2, len(m.Parts))
+	}
+	for i, want := range []string{"text/plain", "text/html"} {
+		p := m.Parts[i]
+		if got := p.DeclaredType(); got != want {
+			t.Errorf("part %d: wrong content type! want %s, got %s", i+1, want, got)
+		}
+		if bytes.Contains(p.Body, []byte("Content-Type")) {
+			t.Errorf("part %d: headers should not be part of the body", i+1)
+		}
+	}
+	if got, want := m.TextBody(), "This is a message to be parsed by the library.\nSo, \"good luck\".\n\n"; got != want {
+		t.Errorf("wrong text body! want %q, got %q", want, got)
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	lf, err := openMessage("mixedalt.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	crlf, err := openMessage("mixedalt-crlf.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(lf.Parts) != len(crlf.Parts) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(lf.Parts), len(crlf.Parts))
+	}
+	if lf.Subject() != crlf.Subject() || lf.MessageID() != crlf.MessageID() {
+		t.Errorf("headers mismatched")
+	}
+	for i := range lf.Parts {
+		a, b := lf.Parts[i], crlf.Parts[i]
+		if a.Path() != b.Path() || a.DeclaredType() != b.DeclaredType() || a.Filename() != b.Filename() {
+			t.Errorf("part %d mismatched", i+1)
+		}
+		if x, y := string(a.Bytes()), strings.ReplaceAll(string(b.Bytes()), "\r\n", "\n"); x != y {
+			t.Errorf("part %d: body mismatched! want %q, got %q", i+1, x, y)
+		}
+	}
+}
+
+func TestCRLFSeparator(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "crlf.txt"))
+	if err != nil {
+		t.Fatalf("fail to open mbox: %s", err)
+	}
+	defer r.Close()
+
+	data := []struct {
+		ID   string
+		Body string
+	}{
+		{
+			ID:   "1111@local.foobar.org",
+			Body: "This is the first message.\r\nFrom here on, no split.\r\n",
+		},
+		{
+			ID:   "2222@local.foobar.org",
+			Body: "This is the second message.\r\nSo, \"good luck\".\r\n",
+		},
+	}
+	var (
+		scan = NewScanner(r)
+		i    int
+	)
+	for ; scan.Scan(); i++ {
+		if i >= len(data) {
+			t.Fatalf("too many messages! want %d, got %d", len(data), i+1)
+		}
+		m := scan.Message()
+		if got := m.MessageID(); got != data[i].ID {
+			t.Errorf("%d: message-id mismatched! want %s, got %s", i+1, data[i].ID, got)
+		}
+		if len(m.Parts) != 1 {
+			t.Fatalf("%d: wrong number of part! want %d, got %d", i+1, 1, len(m.Parts))
+		}
+		if got := string(m.Parts[0].Bytes()); got != data[i].Body {
+			t.Errorf("%d: body mismatched! want %q, got %q", i+1, data[i].Body, got)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if i != len(data) {
+		t.Errorf("wrong number of messages! want %d, got %d", len(data), i)
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	for _, f := range []string{"mixed.txt", "mixedalt-crlf.txt"} {
+		src, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		m, err := openMessage(f)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		var (
+			start = bytes.IndexByte(src, '\n') + 1
+			size  = m.HeaderSize()
+		)
+		if want := headerBlock(src[start:]); size != len(want) {
+			t.Errorf("%s: message header size mismatched! want %d, got %d", f, len(want), size)
+		}
+		for _, p := range m.Parts {
+			if len(p.Header) == 0 {
+				continue
+			}
+			want := headerBlock(src[bytes.Index(src, p.Body)-p.HeaderSize():])
+			if p.HeaderSize() != len(want) || !bytes.HasPrefix(want, []byte("Content-")) {
+				t.Errorf("%s: part %s header size mismatched! got %d", f, p.Path(), p.HeaderSize())
+			}
+		}
+	}
+}
+
+func headerBlock(src []byte) []byte {
+	for _, sep := range []string{"\r\n\r\n", "\n\n"} {
+		if ix := bytes.Index(src, []byte(sep)); ix >= 0 {
+			return src[:ix+len(sep)]
+		}
+	}
+	return src
+}
+
+func TestPartContentType(t *testing.T) {
+	data := []struct {
+		Type    string
+		Main    string
+		Sub     string
+		Charset string
+		Bound   string
+	}{
+		{Type: "", Main: "text", Sub: "plain", Charset: "us-ascii"},
+		{Type: "text/plain", Main: "text", Sub: "plain", Charset: "us-ascii"},
+		{Type: "Text/HTML; charset=UTF-8", Main: "text", Sub: "html", Charset: "utf-8"},
+		{Type: "application/pdf; name=\"file.pdf\"", Main: "application", Sub: "pdf"},
+		{Type: "multipart/mixed; boundary=\"unique-boundary\"", Main: "multipart", Sub: "mixed", Bound: "unique-boundary"},
+		{Type: "text/plain; boundary=\"unique-boundary\"", Main: "text", Sub: "plain", Charset: "us-ascii"},
+	}
+	for _, d := range data {
+		p := Part{Header: make(Header)}
+		if d.Type != "" {
+			p.Set(hdrContentType, d.Type)
+		}
+		main, sub := p.ContentType()
+		if main != d.Main || sub != d.Sub {
+			t.Errorf("%s: type mismatched! want %s/%s, got %s/%s", d.Type, d.Main, d.Sub, main, sub)
+		}
+		if got := p.Charset(); got != d.Charset {
+			t.Errorf("%s: charset mismatched! want %s, got %s", d.Type, d.Charset, got)
+		}
+		if got := p.Boundary(); got != d.Bound {
+			t.Errorf("%s: boundary mismatched! want %s, got %s", d.Type, d.Bound, got)
+		}
+	}
+}
+
+func TestHasReadableBody(t *testing.T) {
+	data := []struct {
+		File string
+		Want bool
+	}{
+		{File: "simple.txt", Want: true},
+		{File: "mixed.txt", Want: true},
+		{File: "html.txt", Want: true},
+		{File: "attachonly.txt", Want: false},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if got := m.HasReadableBody(); got != d.Want {
+			t.Errorf("%s: readable body mismatched! want %t, got %t", d.File, d.Want, got)
+		}
+	}
+}
+
+func TestUnwrappedBase64(t *testing.T) {
+	data := make([]byte, 3<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var str strings.Builder
+	str.WriteString("From midbel@foobar.org Wed Jan 22 11:15:00 2020\n")
+	str.WriteString("MIME-Version: 1.0\n")
+	str.WriteString("From: midbel <midbel@foobar.org>\n")
+	str.WriteString("Subject: mbox test\n")
+	str.WriteString("Content-Type: multipart/mixed;boundary=\"unique-boundary\"\n\n")
+	str.WriteString("--unique-boundary\n")
+	str.WriteString("Content-Type: application/octet-stream\n")
+	str.WriteString("Content-Disposition: attachment; filename=\"data.bin\"\n")
+	str.WriteString("Content-Transfer-Encoding: base64\n\n")
+	str.WriteString(base64.StdEncoding.EncodeToString(data))
+	str.WriteString("\n--unique-boundary--\n")
+
+	m, err := ReadMessage(bufio.NewReader(strings.NewReader(str.String())))
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(m.Parts) != 1 {
+		t.Fatalf("wrong number of part! want %d, got %d", 1, len(m.Parts))
+	}
+	got, err := m.Parts[0].DecodedBody()
+	if err != nil {
+		t.Fatalf("fail to decode attachment: %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("attachment mismatched! want %d bytes, got %d bytes", len(data), len(got))
+	}
+}
+
+func TestEncodedMultipart(t *testing.T) {
+	m, err := openMessage("multipart-encoded.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []struct {
+		Path string
+		Type string
+	}{
+		{Path: "1.1", Type: "text/plain"},
+		{Path: "1.2", Type: "text/html"},
+		{Path: "2", Type: "text/plain"},
+	}
+	if len(m.Parts) != len(want) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(want), len(m.Parts))
+	}
+	for i, p := range m.Parts {
+		if p.Path() != want[i].Path || p.DeclaredType() != want[i].Type {
+			t.Errorf("wrong part! want %s/%s, got %s/%s", want[i].Path, want[i].Type, p.Path(), p.DeclaredType())
+		}
+	}
+	if got := string(m.Parts[2].Bytes()); got != "hello world" {
+		t.Errorf("attachment mismatched! want %q, got %q", "hello world", got)
+	}
+	m.WalkParts(func(p Part, _ int) error {
+		if !p.IsMultipart() {
+			return nil
+		}
+		body, err := p.DecodedBody()
+		if err != nil || !bytes.Equal(body, p.Body) {
+			t.Errorf("%s: multipart body should not be decoded", p.Path())
+		}
+		return nil
+	})
+	if issues := m.QualityReport(); len(issues) != 0 {
+		t.Errorf("unexpected issues: %v", issues)
+	}
+}
+
+func TestEach(t *testing.T) {
+	m, err := openMessage("mixedalt.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []string{
+		"Mime-Version=1.0",
+		"From=midbel <midbel@foobar.org>",
+		"To=rustine <rustine@foobar.org>",
+		"Subject=mbox test",
+		"Date=Wed, 22 Jan 2020 11:15:00 +0200",
+		"Message-Id=<5678@local.foobar.org>",
+		"Content-Type=multipart/alternative;boundary=\"unique-boundary\"",
+		"1/Content-Type=multipart/alternative;boundary=\"another-boundary\"",
+		"1.1/Content-Type=text/plain;charset=utf-8",
+		"1.2/Content-Type=text/html;charset=utf-8",
+		"2/Content-Disposition=attachment; filename=\"sample.go\"",
+		"2/Content-Transfer-Encoding=bit8",
+		"2/Content-Type=text/html;charset=utf-8",
+	}
+	for i := 0; i < 2; i++ {
+		var got []string
+		m.Each(func(field, value string) {
+			got = append(got, field+"="+value)
+		})
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("fields mismatched! want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	want := []string{"Mime-Version", "From", "To", "Subject", "Date", "Message-Id", "Content-Type"}
+	for i := 0; i < 5; i++ {
+		m, err := openMessage("mixedalt.txt")
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if got := m.Keys(); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("keys mismatched! want %v, got %v", want, got)
+		}
+		if got := m.Parts[len(m.Parts)-1].Keys(); len(got) != 3 || got[0] != "Content-Disposition" {
+			t.Errorf("part keys mismatched! got %v", got)
+		}
+		m.Set("X-Label", "mbox")
+		m.Del("To")
+		want := []string{"Mime-Version", "From", "Subject", "Date", "Message-Id", "Content-Type", "X-Label"}
+		if got := m.Keys(); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("keys mismatched after update! want %v, got %v", want, got)
+		}
+	}
+	hdr := Header{"To": nil, "From": nil, "Date": nil}
+	if got := hdr.Keys(); strings.Join(got, ",") != "Date,From,To" {
+		t.Errorf("header keys should be sorted! got %v", got)
+	}
+}
+
+func TestSignedPart(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "signed.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	m, err := openMessage("signed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	content, sig, ok := m.SignedPart()
+	if !ok {
+		t.Fatalf("signed parts not found")
+	}
+	var (
+		start = bytes.Index(src, []byte("--signed-boundary\r\n")) + len("--signed-boundary\r\n")
+		end   = bytes.Index(src, []byte("\r\n--signed-boundary\r\nContent-Type: application"))
+	)
+	if want := src[start:end]; !bytes.Equal(content.Raw(), want) {
+		t.Errorf("signed content mismatched! want %q, got %q", want, content.Raw())
+	}
+	if !content.IsMultipart() || content.Path() != "1" {
+		t.Errorf("signed content should not be flattened")
+	}
+	if main, sub := sig.ContentType(); main != "application" || sub != "pgp-signature" {
+		t.Errorf("wrong signature type! got %s/%s", main, sub)
+	}
+	if !bytes.HasSuffix(sig.Raw(), []byte("-----END PGP SIGNATURE-----\r\n")) {
+		t.Errorf("signature mismatched! got %q", sig.Raw())
+	}
+	if got := m.TextBody(); !strings.Contains(got, "And here, it is signed.") {
+		t.Errorf("text body should still be readable! got %q", got)
+	}
+	if _, _, ok := m.EncryptedPart(); ok {
+		t.Errorf("message should not have encrypted parts")
+	}
+
+	m, err = openMessage("encrypted.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	ctrl, data, ok := m.EncryptedPart()
+	if !ok {
+		t.Fatalf("encrypted parts not found")
+	}
+	if want := "Content-Type: application/pgp-encrypted\nContent-Description: PGP/MIME version identification\n\nVersion: 1\n"; string(ctrl.Raw()) != want {
+		t.Errorf("control part mismatched! want %q, got %q", want, ctrl.Raw())
+	}
+	if data.Path() != "1.2" || !bytes.HasSuffix(data.Raw(), []byte("-----END PGP MESSAGE-----\n")) {
+		t.Errorf("encrypted data mismatched! got %s: %q", data.Path(), data.Raw())
+	}
+	if _, _, ok := m.SignedPart(); ok {
+		t.Errorf("message should not have signed parts")
+	}
+	for _, p := range m.Parts {
+		if p.Raw() != nil && !strings.HasPrefix(p.Path(), "1.") {
+			t.Errorf("%s: raw bytes should only be kept for encrypted parts", p.Path())
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	data := []struct {
+		Addr string
+		Want string
+	}{
+		{Addr: "boss@corp.com", Want: "boss@corp.com"},
+		{Addr: "Boss@Corp.COM", Want: "boss@corp.com"},
+		{Addr: " <Boss@Corp.com> ", Want: "boss@corp.com"},
+		{Addr: "", Want: ""},
+	}
+	for _, d := range data {
+		if got := NormalizeAddress(d.Addr); got != d.Want {
+			t.Errorf("%s: address mismatched! want %s, got %s", d.Addr, d.Want, got)
+		}
+	}
+}
+
+func TestSpecialBoundary(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "boundary-special.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	want := []struct {
+		Boundary string
+		Types    []string
+	}{
+		{Boundary: "----=_Part_42:a=b?(c)/d.e", Types: []string{"text/plain", "text/plain"}},
+		{Boundary: "----=_NextPart_000_0001", Types: []string{"text/plain", "text/html"}},
+	}
+	scan := NewScanner(r)
+	for i := 0; scan.Scan(); i++ {
+		m := scan.Message()
+		if i >= len(want) {
+			t.Fatalf("too many messages")
+		}
+		if got := (Part{Header: m.Header}).Boundary(); got != want[i].Boundary {
+			t.Errorf("%d: boundary mismatched! want %q, got %q", i+1, want[i].Boundary, got)
+		}
+		var types []string
+		for _, p := range m.Parts {
+			types = append(types, p.DeclaredType())
+		}
+		if strings.Join(types, ",") != strings.Join(want[i].Types, ",") {
+			t.Errorf("%d: parts mismatched! want %v, got %v", i+1, want[i].Types, types)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+}
+
+func TestMalformedContentType(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "malformed-ctype.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	want := []struct {
+		Multipart bool
+		Types     []string
+	}{
+		{Multipart: true, Types: []string{"text/plain", "text/plain"}},
+		{Multipart: true, Types: []string{"text/plain", "text/html"}},
+		{Multipart: false, Types: []string{"text/plain"}},
+		{Multipart: true, Types: []string{"multipart/alternative", "text/plain"}},
+	}
+	var (
+		scan = NewScanner(r)
+		i    int
+	)
+	for ; scan.Scan(); i++ {
+		m := scan.Message()
+		if i >= len(want) {
+			t.Fatalf("too many messages")
+		}
+		if got := m.IsMultipart(); got != want[i].Multipart {
+			t.Errorf("%s: multipart mismatched! want %t, got %t", m.Subject(), want[i].Multipart, got)
+		}
+		var types []string
+		for _, p := range m.Parts {
+			main, sub := p.ContentType()
+			types = append(types, main+"/"+sub)
+		}
+		if strings.Join(types, ",") != strings.Join(want[i].Types, ",") {
+			t.Errorf("%s: parts mismatched! want %v, got %v", m.Subject(), want[i].Types, types)
+		}
+		for _, p := range m.Parts {
+			if len(p.Body) == 0 {
+				t.Errorf("%s: empty body for part %s", m.Subject(), p.Path())
+			}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if i != len(want) {
+		t.Errorf("wrong number of messages! want %d, got %d", len(want), i)
+	}
+}
+
+func TestEncodedContainer(t *testing.T) {
+	m, err := openMessage("encoded-container.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []string{"1.1:text/plain", "1.2:text/html", "2:text/plain"}
+	var got []string
+	for _, p := range m.Parts {
+		got = append(got, p.Path()+":"+p.DeclaredType())
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("parts mismatched! want %v, got %v", want, got)
+	}
+	if body := m.TextBody(); !strings.HasPrefix(body, "This is a message to be parsed") {
+		t.Errorf("wrong text body: %q", body)
+	}
+}
+
+func TestLabelledContainer(t *testing.T) {
+	m, err := openMessage("qp-labelled-container.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []string{"1.1:text/plain", "1.2:text/html"}
+	var got []string
+	for _, p := range m.Parts {
+		got = append(got, p.Path()+":"+p.DeclaredType())
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("parts mismatched! want %v, got %v", want, got)
+	}
+	if body := m.TextBody(); strings.TrimSpace(body) != "a=b" {
+		t.Errorf("wrong text body! want %q, got %q", "a=b", body)
+	}
+	html, err := m.Parts[1].DecodedBody()
+	if err != nil {
+		t.Fatalf("fail to decode html part: %s", err)
+	}
+	if body := strings.TrimSpace(string(html)); body != `<p class="x">a=3Db</p>` {
+		t.Errorf("wrong html body! want %q, got %q", `<p class="x">a=3Db</p>`, body)
+	}
+}
+
+func TestBoundaryConflict(t *testing.T) {
+	m, err := openMessage("boundary-prefix.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []string{"1.1:text/plain", "1.2:text/html", "2:text/plain"}
+	var got []string
+	for _, p := range m.Parts {
+		got = append(got, p.Path()+":"+p.DeclaredType())
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("parts mismatched! want %v, got %v", want, got)
+	}
+
+	_, err = openMessage("boundary-conflict.txt")
+	if !errors.Is(err, ErrBoundaryConflict) {
+		t.Errorf("conflicting boundaries should be reported! want %s, got %v", ErrBoundaryConflict, err)
+	}
+}
+
+func TestRawBoundary(t *testing.T) {
+	data := []struct {
+		Input string
+		Want  string
+	}{
+		{Input: `multipart/mixed; boundary="simple"`, Want: "simple"},
+		{Input: `multipart/mixed; BOUNDARY = "a;b=c" ; charset=utf-8`, Want: "a;b=c"},
+		{Input: `multipart/mixed; boundary=----=_Part_1 `, Want: "----=_Part_1"},
+		{Input: `multipart/mixed; x-boundary=other; boundary=right`, Want: "right"},
+		{Input: `multipart/mixed; charset=utf-8`, Want: ""},
+	}
+	for _, d := range data {
+		if got := rawBoundary(d.Input); got != d.Want {
+			t.Errorf("%s: boundary mismatched! want %q, got %q", d.Input, d.Want, got)
+		}
+	}
+}
+
+func TestPreferredAlternative(t *testing.T) {
+	data := []struct {
+		File  string
+		Types []string
+		Path  string
+	}{
+		{File: "alternative.txt", Types: []string{"text/html", "text/plain"}, Path: "2"},
+		{File: "alternative.txt", Types: []string{"text/plain", "text/html"}, Path: "1"},
+		{File: "alternative.txt", Path: "2"},
+		{File: "alternative.txt", Types: []string{"image/png"}},
+		{File: "related.txt", Types: []string{"text/html", "text/plain"}, Path: "1.2.1"},
+		{File: "related.txt", Types: []string{"TEXT/PLAIN", "text/html"}, Path: "1.1"},
+		{File: "related.txt", Types: []string{"image/png"}},
+		{File: "mixed.txt", Types: []string{"text/html", "text/plain"}, Path: "1"},
+		{File: "simple.txt", Types: []string{"text/html", "text/plain"}, Path: "1"},
+		{File: "simple.txt", Types: []string{"text/html"}},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", d.File, err)
+		}
+		p, ok := m.PreferredAlternative(d.Types...)
+		if ok != (d.Path != "") {
+			t.Errorf("%s %v: alternative should be found: %t", d.File, d.Types, d.Path != "")
+			continue
+		}
+		if p.Path() != d.Path {
+			t.Errorf("%s %v: wrong alternative! want %s, got %s", d.File, d.Types, d.Path, p.Path())
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	m, err := openMessage("mixed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	var (
+		subject = m.Subject()
+		body    = string(m.Parts[0].Body)
+		parts   = len(m.Parts)
+		c       = m.Clone()
+	)
+	c.Set("Subject", "cloned")
+	c.Add("Received", "from mail.foobar.org")
+	c.Del("Date")
+	c.Values("To")[0] = "nobody@foobar.org"
+	c.Parts[0].Set("Content-Type", "text/html")
+	c.Parts[0].Body[0] = '#'
+	c.Parts = append(c.Parts, Part{})
+
+	if got := m.Subject(); got != subject {
+		t.Errorf("wrong subject! want %s, got %s", subject, got)
+	}
+	if m.Has("Received") || !m.Has("Date") {
+		t.Errorf("header of the original message modified")
+	}
+	if got := m.Get("To"); got == "nobody@foobar.org" {
+		t.Errorf("values of the original message modified")
+	}
+	if got := m.Parts[0].DeclaredType(); got != "text/plain" {
+		t.Errorf("wrong part type! want %s, got %s", "text/plain", got)
+	}
+	if got := string(m.Parts[0].Body); got != body {
+		t.Errorf("wrong part body! want %q, got %q", body, got)
+	}
+	if len(m.Parts) != parts {
+		t.Errorf("wrong number of parts! want %d, got %d", parts, len(m.Parts))
+	}
+}
@@ -0,0 +1,234 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultMaxParts = 1000
+	DefaultMaxDepth = 100
+)
+
+var (
+	ErrTooManyParts     = errors.New("too many parts")
+	ErrTooDeep          = errors.New("multipart nested too deeply")
+	ErrUnterminatedPart = errors.New("unterminated part")
+	ErrBoundaryConflict = errors.New("boundary conflicts with an enclosing boundary")
+	ErrInvalidLength    = errors.New("invalid content length")
+)
+
+type Option func(*reader)
+
+// MaxParts limits the number of MIME parts, including nested multipart
+// containers, that a single message can have. A value lower or equal to zero
+// disables the limit.
+func MaxParts(n int) Option {
+	return func(r *reader) {
+		r.maxParts = n
+	}
+}
+
+// MaxDepth limits how deeply multipart containers can be nested in a single
+// message. A value lower or equal to zero disables the limit.
+func MaxDepth(n int) Option {
+	return func(r *reader) {
+		r.maxDepth = n
+	}
+}
+
+// MaxPartSize limits the number of bytes kept for the body of each part of a
+// message. The bytes exceeding the limit are discarded, the part is flagged as
+// Truncated and the message as Partial. A value lower or equal to zero disables
+// the limit.
+func MaxPartSize(n int) Option {
+	return func(r *reader) {
+		r.maxPartSize = n
+	}
+}
+
+// Lenient makes the reader tolerant to malformed input. A leading byte order
+// mark and any content found before a From line are discarded, and the parts
+// that could be salvaged from a malformed message are kept. The error
+// reporting the problem is still returned alongside the message, except for
+// the multipart messages without any delimiter: they are returned without
+// parts, as reported by Validate.
+func Lenient() Option {
+	return func(r *reader) {
+		r.lenient = true
+	}
+}
+
+// StrictFromLine only accepts as message separator the From lines followed by
+// an address and a date, as in "From user@example.org Wed Jan 22 11:15:00 2020".
+// Other lines starting with "From " are kept in the body of the message.
+func StrictFromLine() Option {
+	return func(r *reader) {
+		r.strict = true
+	}
+}
+
+// SloppyFromLine accepts as message separator the From lines written with
+// tabs or several spaces after "From", as some producers do. Like with
+// StrictFromLine, the From lines should be followed by an address and a date
+// to separate messages.
+func SloppyFromLine() Option {
+	return func(r *reader) {
+		r.sloppy = true
+	}
+}
+
+// DefaultCharset sets the charset used to decode the text parts that do not
+// declare one. It defaults to us-ascii as defined by RFC 2045.
+func DefaultCharset(charset string) Option {
+	return func(r *reader) {
+		r.charset = charset
+	}
+}
+
+// Preview stops reading the parts of a multipart message once a text/plain or
+// text/html body has been found. The remaining parts, including attachments,
+// are skipped and the message is flagged as Partial.
+func Preview() Option {
+	return func(r *reader) {
+		r.preview = true
+	}
+}
+
+// KeepRaw stores the bytes of the message, as they appear in the mailbox, in
+// Message.Raw. The From line separating the messages is not included.
+func KeepRaw() Option {
+	return func(r *reader) {
+		r.keepRaw = true
+	}
+}
+
+// KeepRawHeader stores the header of the message, as it appears in the mailbox
+// and including the blank line ending it, in Message.RawHeader. The parsed
+// Header canonicalizes the keys, unfolds and trims the values and loses the
+// order of the fields: RawHeader is the one to use to verify signatures.
+func KeepRawHeader() Option {
+	return func(r *reader) {
+		r.keepRawHeader = true
+	}
+}
+
+// KeepPreamble stores the text found before the first boundary and after the
+// closing boundary of a multipart message in Message.Preamble and
+// Message.Epilog. The blank line separating the message from the next one is
+// not part of the epilog.
+func KeepPreamble() Option {
+	return func(r *reader) {
+		r.keepPreamble = true
+	}
+}
+
+// Gunzip decompresses the body of the parts declaring a gzip Content-Encoding
+// once their transfer encoding has been decoded.
+func Gunzip() Option {
+	return func(r *reader) {
+		r.gunzip = true
+	}
+}
+
+// WithContentTypeParser replaces the parser used for the Content-Type headers
+// of the messages and their parts.
+func WithContentTypeParser(parser ContentTypeParser) Option {
+	return func(r *reader) {
+		r.parser = parser
+	}
+}
+
+// Stat describes how a message has been read. Offset and Size are given in
+// bytes from the start of the reader, Err is the error returned with the
+// message if any.
+type Stat struct {
+	Offset  int64
+	Size    int64
+	Parts   int
+	Elapsed time.Duration
+	Err     error
+}
+
+// WithObserver calls fn with the Stat of each message once it has been read.
+// fn is called synchronously by the reader, so the next message is not read
+// until fn returns.
+func WithObserver(fn func(Stat)) Option {
+	return func(r *reader) {
+		r.observer = fn
+	}
+}
+
+type reader struct {
+	ctx     context.Context
+	lenient bool
+	strict  bool
+	sloppy  bool
+	preview bool
+	partial bool
+	keepRaw bool
+	gunzip  bool
+	charset string
+	parser  ContentTypeParser
+
+	observer func(Stat)
+
+	src     *bufio.Reader
+	capture bool
+	raw     []byte
+
+	keepRawHeader bool
+
+	keepPreamble bool
+	preamble     []byte
+	epilog       []byte
+
+	teeing bool
+	tee    []byte
+	groups []partGroup
+
+	offset     int64
+	lines      int
+	lineOffset int64
+	line       int
+	fromOffset int64
+
+	maxParts    int
+	maxDepth    int
+	maxPartSize int
+	parts       int
+	path        []int
+	boundaries  [][]byte
+
+	containers []Part
+}
+
+func newReader(ctx context.Context, opts ...Option) *reader {
+	r := reader{
+		ctx:      ctx,
+		charset:  charsetASCII,
+		maxParts: DefaultMaxParts,
+		maxDepth: DefaultMaxDepth,
+	}
+	for _, o := range opts {
+		o(&r)
+	}
+	return &r
+}
+
+func (r *reader) record(rs *bufio.Reader, bs []byte) {
+	if r.teeing {
+		r.tee = append(r.tee, bs...)
+	}
+	if rs != r.src {
+		return
+	}
+	r.offset += int64(len(bs))
+	r.lines += bytes.Count(bs, []byte("\n"))
+	if r.keepRaw && r.capture {
+		r.raw = append(r.raw, bs...)
+	}
+}
@@ -0,0 +1,612 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaxParts(t *testing.T) {
+	msg := multipartMessage(20)
+	if _, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)), MaxParts(10)); !errors.Is(err, ErrTooManyParts) {
+		t.Errorf("unexpected error! want %s, got %v", ErrTooManyParts, err)
+	}
+	m, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)))
+	if err != nil {
+		t.Fatalf("unexpected error with default limit: %s", err)
+	}
+	if len(m.Parts) != 20 {
+		t.Errorf("wrong number of part! want %d, got %d", 20, len(m.Parts))
+	}
+	if _, err := ReadMessage(bufio.NewReader(strings.NewReader(multipartMessage(DefaultMaxParts + 1)))); !errors.Is(err, ErrTooManyParts) {
+		t.Errorf("unexpected error! want %s, got %v", ErrTooManyParts, err)
+	}
+	if _, err := ReadMessage(bufio.NewReader(strings.NewReader(multipartMessage(DefaultMaxParts+1))), MaxParts(0)); err != nil {
+		t.Errorf("unexpected error without limit: %s", err)
+	}
+}
+
+func multipartMessage(n int) string {
+	var str strings.Builder
+	str.WriteString("From midbel@foobar.org Wed Jan 22 11:15:00 2020\n")
+	str.WriteString("MIME-Version: 1.0\n")
+	str.WriteString("From: midbel <midbel@foobar.org>\n")
+	str.WriteString("Subject: mbox test\n")
+	str.WriteString("Content-Type: multipart/mixed;boundary=\"unique-boundary\"\n\n")
+	for i := 0; i < n; i++ {
+		str.WriteString("--unique-boundary\n")
+		str.WriteString("Content-Type: text/plain\n\n")
+		fmt.Fprintf(&str, "part #%d\n", i+1)
+	}
+	str.WriteString("--unique-boundary--\n")
+	return str.String()
+}
+
+func TestMaxDepth(t *testing.T) {
+	msg := nestedMessage(20)
+	if _, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)), MaxDepth(10)); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("unexpected error! want %s, got %v", ErrTooDeep, err)
+	}
+	m, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)))
+	if err != nil {
+		t.Fatalf("unexpected error with default limit: %s", err)
+	}
+	if len(m.Parts) != 1 {
+		t.Fatalf("wrong number of part! want %d, got %d", 1, len(m.Parts))
+	}
+	if want := strings.Repeat("1.", 19) + "1"; m.Parts[0].Path() != want {
+		t.Errorf("wrong part path! want %s, got %s", want, m.Parts[0].Path())
+	}
+	if _, err := ReadMessage(bufio.NewReader(strings.NewReader(nestedMessage(DefaultMaxDepth + 1)))); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("unexpected error! want %s, got %v", ErrTooDeep, err)
+	}
+	if _, err := ReadMessage(bufio.NewReader(strings.NewReader(nestedMessage(DefaultMaxDepth+1))), MaxDepth(0)); err != nil {
+		t.Errorf("unexpected error without limit: %s", err)
+	}
+}
+
+func nestedMessage(depth int) string {
+	var str strings.Builder
+	str.WriteString("From midbel@foobar.org Wed Jan 22 11:15:00 2020\n")
+	str.WriteString("MIME-Version: 1.0\n")
+	str.WriteString("From: midbel <midbel@foobar.org>\n")
+	str.WriteString("Subject: mbox test\n")
+	fmt.Fprintf(&str, "Content-Type: multipart/mixed;boundary=\"boundary-%d\"\n\n", 1)
+	for i := 1; i < depth; i++ {
+		fmt.Fprintf(&str, "--boundary-%d\n", i)
+		fmt.Fprintf(&str, "Content-Type: multipart/mixed;boundary=\"boundary-%d\"\n\n", i+1)
+	}
+	fmt.Fprintf(&str, "--boundary-%d\n", depth)
+	str.WriteString("Content-Type: text/plain\n\n")
+	str.WriteString("deeply nested\n")
+	for i := depth; i > 0; i-- {
+		fmt.Fprintf(&str, "--boundary-%d--\n", i)
+	}
+	return str.String()
+}
+
+func TestUnterminatedPart(t *testing.T) {
+	data := []struct {
+		Options []Option
+		Parts   int
+	}{
+		{
+			Parts: 0,
+		},
+		{
+			Options: []Option{Lenient()},
+			Parts:   2,
+		},
+	}
+	for _, d := range data {
+		r, err := os.Open(filepath.Join("testdata", "unterminated.txt"))
+		if err != nil {
+			t.Fatalf("fail to open testdata: %s", err)
+		}
+		defer r.Close()
+
+		rs := bufio.NewReader(r)
+		m, err := ReadMessage(rs, d.Options...)
+		if !errors.Is(err, ErrUnterminatedPart) {
+			t.Errorf("unexpected error! want %s, got %v", ErrUnterminatedPart, err)
+		}
+		if len(m.Parts) != d.Parts {
+			t.Errorf("wrong number of part! want %d, got %d", d.Parts, len(m.Parts))
+		}
+		m, err = ReadMessage(rs, d.Options...)
+		if err != nil {
+			t.Fatalf("fail to read next message: %s", err)
+		}
+		if got := m.Get("message-id"); got != "<1234@local.foobar.org>" {
+			t.Errorf("wrong message! want %s, got %s", "<1234@local.foobar.org>", got)
+		}
+	}
+}
+
+func TestDefaultCharset(t *testing.T) {
+	const msg = "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"MIME-Version: 1.0\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: mbox test\n" +
+		"Content-Type: text/plain\n\n" +
+		"caf\xe9\n"
+	data := []struct {
+		Options []Option
+		Want    string
+	}{
+		{
+			Want: "caf�\n",
+		},
+		{
+			Options: []Option{DefaultCharset("iso-8859-1")},
+			Want:    "café\n",
+		},
+		{
+			Options: []Option{DefaultCharset("utf-8")},
+			Want:    "caf\xe9\n",
+		},
+	}
+	for _, d := range data {
+		m, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)), d.Options...)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if got := m.TextBody(); got != d.Want {
+			t.Errorf("wrong text body! want %q, got %q", d.Want, got)
+		}
+	}
+}
+
+func TestSkipToFirstMessage(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "preamble.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	if _, err := ReadMessage(bufio.NewReader(bytes.NewReader(bs))); err == nil {
+		t.Errorf("strict mode should reject leading garbage")
+	}
+
+	rs := bufio.NewReader(bytes.NewReader(bs))
+	if err := SkipToFirstMessage(rs); err != nil {
+		t.Fatalf("fail to skip leading garbage: %s", err)
+	}
+	m, err := ReadMessage(rs)
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if got := m.MessageID(); got != "1234@local.foobar.org" {
+		t.Errorf("wrong message id! want %s, got %s", "1234@local.foobar.org", got)
+	}
+
+	m, err = ReadMessage(bufio.NewReader(bytes.NewReader(bs)), Lenient())
+	if err != nil {
+		t.Fatalf("fail to parse mbox in lenient mode: %s", err)
+	}
+	if got := m.MessageID(); got != "1234@local.foobar.org" {
+		t.Errorf("wrong message id! want %s, got %s", "1234@local.foobar.org", got)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "mixed.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	rs := bufio.NewReader(io.MultiReader(r, strings.NewReader("\n"), strings.NewReader(multipartMessage(2))))
+	m, err := ReadMessage(rs, Preview())
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if !m.Partial {
+		t.Errorf("message should be flagged as partially parsed")
+	}
+	if len(m.Parts) != 1 || m.HasAttachments() {
+		t.Errorf("attachments should not be loaded in preview mode")
+	}
+	if m.TextBody() == "" {
+		t.Errorf("text body should be loaded in preview mode")
+	}
+
+	m, err = ReadMessage(rs, Preview())
+	if err != nil {
+		t.Fatalf("fail to parse next message: %s", err)
+	}
+	if len(m.Parts) != 1 || !m.Partial {
+		t.Errorf("next message should be read in preview mode")
+	}
+}
+
+func TestKeepRaw(t *testing.T) {
+	for _, f := range []string{"dupes.txt", "mixedalt.txt", "mboxcl.txt", "mixedalt-crlf.txt", "crlf.txt"} {
+		want, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		var (
+			scan = NewScanner(bytes.NewReader(want), KeepRaw())
+			got  bytes.Buffer
+		)
+		for scan.Scan() {
+			m := scan.Message()
+			if len(m.Raw) == 0 {
+				t.Errorf("%s: raw message not captured", f)
+			}
+			if bytes.HasPrefix(m.Raw, []byte(fromLinePrefix)) {
+				t.Errorf("%s: raw message includes From line", f)
+			}
+			got.WriteString(m.FromLine)
+			if bytes.HasPrefix(want[got.Len():], []byte("\r\n")) {
+				got.WriteString("\r")
+			}
+			got.WriteString("\n")
+			got.Write(m.Raw)
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", f, err)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("%s: raw messages mismatched! want %q, got %q", f, want, got.Bytes())
+		}
+	}
+	m, err := openMessage("simple.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if m.Raw != nil {
+		t.Errorf("raw message captured without KeepRaw")
+	}
+}
+
+func TestGunzip(t *testing.T) {
+	const want = "package main\n\nfunc main() {\n  println(\"hello world\")\n}\n"
+	data := []struct {
+		Options []Option
+		Gunzip  bool
+	}{
+		{},
+		{
+			Options: []Option{Gunzip()},
+			Gunzip:  true,
+		},
+	}
+	for _, d := range data {
+		r, err := os.Open(filepath.Join("testdata", "gzip.txt"))
+		if err != nil {
+			t.Fatalf("fail to open testdata: %s", err)
+		}
+		defer r.Close()
+
+		m, err := ReadMessage(bufio.NewReader(r), d.Options...)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if len(m.Parts) != 2 {
+			t.Fatalf("wrong number of part! want %d, got %d", 2, len(m.Parts))
+		}
+		got := m.Parts[1].Bytes()
+		if d.Gunzip && string(got) != want {
+			t.Errorf("attachment mismatched! want %q, got %q", want, got)
+		}
+		if !d.Gunzip && !bytes.HasPrefix(got, []byte{0x1f, 0x8b}) {
+			t.Errorf("attachment should not be decompressed! got %q", got)
+		}
+		if body := m.Parts[0].Bytes(); !bytes.HasPrefix(body, []byte("This is a message")) {
+			t.Errorf("text body altered: %q", body)
+		}
+	}
+}
+
+func TestContentTypeParser(t *testing.T) {
+	var calls int
+	parser := ContentTypeParserFunc(func(str string) (string, map[string]string, error) {
+		calls++
+		return mime.ParseMediaType(str)
+	})
+	r, err := os.Open(filepath.Join("testdata", "mixedalt.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	m, err := ReadMessage(bufio.NewReader(r), WithContentTypeParser(parser))
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if calls == 0 {
+		t.Fatalf("custom parser not called")
+	}
+	want := []string{"text/plain", "text/html", "text/html"}
+	if len(m.Parts) != len(want) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(want), len(m.Parts))
+	}
+	for i, p := range m.Parts {
+		if got := p.DeclaredType(); got != want[i] {
+			t.Errorf("%s: wrong type! want %s, got %s", p.Path(), want[i], got)
+		}
+	}
+	if got := m.Parts[0].Charset(); got != "utf-8" {
+		t.Errorf("wrong charset! want %s, got %s", "utf-8", got)
+	}
+}
+
+func TestStrictFromLine(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "prose.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	var (
+		scan = NewScanner(r, StrictFromLine())
+		ms   []Message
+	)
+	for scan.Scan() {
+		ms = append(ms, scan.Message())
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if len(ms) != 3 {
+		t.Fatalf("wrong number of messages! want %d, got %d", 3, len(ms))
+	}
+	bodies := []string{
+		"From here you can see the sea.\nFrom there, the mountains.\n",
+		"From the bridge, walk down to the river.\n\n",
+		"From what you said, it is far away.\n",
+	}
+	for i, want := range bodies {
+		if got := ms[i].TextBody(); !strings.HasSuffix(got, want) {
+			t.Errorf("%d: wrong body! want %q, got %q", i+1, want, got)
+		}
+	}
+}
+
+func TestValidFromLine(t *testing.T) {
+	data := []struct {
+		Line  string
+		Valid bool
+	}{
+		{Line: "From midbel@foobar.org Wed Jan 22 11:15:00 2020", Valid: true},
+		{Line: "From midbel@foobar.org  Fri Jan  3 08:05:00 2020", Valid: true},
+		{Line: "From MAILER-DAEMON Thu Jan 23 09:00:00 +0000 2020", Valid: true},
+		{Line: "From midbel@foobar.org Thu Jan 23 09:00:00 2020 +0100", Valid: true},
+		{Line: "From midbel@foobar.org Thu Jan 23 09:00 2020", Valid: true},
+		{Line: "From here you can see the sea.", Valid: false},
+		{Line: "From midbel@foobar.org", Valid: false},
+		{Line: "From ", Valid: false},
+		{Line: "From\tmidbel@foobar.org\tThu Jan 23 09:00:00 2020", Valid: true},
+		{Line: "From  midbel@foobar.org  Thu Jan 23 09:00:00 2020", Valid: true},
+		{Line: "From\there you can see the sea.", Valid: false},
+		{Line: "Fromage Thu Jan 23 09:00:00 2020", Valid: false},
+	}
+	for _, d := range data {
+		if got := validFromLine([]byte(d.Line)); got != d.Valid {
+			t.Errorf("%q: validity mismatched! want %t, got %t", d.Line, d.Valid, got)
+		}
+	}
+}
+
+func TestMaxPartSize(t *testing.T) {
+	const limit = 16
+	for _, f := range []string{"mboxcl.txt", "mixedalt.txt", "dupes.txt"} {
+		src, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		var (
+			all    = NewScanner(bytes.NewReader(src))
+			capped = NewScanner(bytes.NewReader(src), MaxPartSize(limit), KeepRaw())
+		)
+		for all.Scan() {
+			if !capped.Scan() {
+				t.Fatalf("%s: fail to parse capped message: %s", f, capped.Err())
+			}
+			var (
+				want = all.Message()
+				got  = capped.Message()
+			)
+			if got.MessageID() != want.MessageID() || len(got.Parts) != len(want.Parts) {
+				t.Errorf("%s: capped message mismatched! want %s, got %s", f, want.MessageID(), got.MessageID())
+				continue
+			}
+			if !got.Partial {
+				t.Errorf("%s: message should be flagged as partial", f)
+			}
+			for i, p := range got.Parts {
+				if len(p.Body) > limit {
+					t.Errorf("%s: part %s too large! want %d, got %d", f, p.Path(), limit, len(p.Body))
+				}
+				if !p.Truncated() || !bytes.HasPrefix(want.Parts[i].Body, p.Body) {
+					t.Errorf("%s: part %s should be truncated", f, p.Path())
+				}
+			}
+			if !bytes.Contains(src, got.Raw) || len(got.Raw) <= got.HeaderSize()+limit {
+				t.Errorf("%s: truncated bytes missing from raw message", f)
+			}
+		}
+		if capped.Scan() {
+			t.Errorf("%s: too many messages", f)
+		}
+	}
+	r, err := os.Open(filepath.Join("testdata", "mixed.txt"))
+	if err != nil {
+		t.Fatalf("fail to open testdata: %s", err)
+	}
+	defer r.Close()
+
+	m, err := ReadMessage(bufio.NewReader(r), MaxPartSize(1<<20))
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	for _, p := range m.Parts {
+		if p.Truncated() {
+			t.Errorf("part %s should not be truncated", p.Path())
+		}
+	}
+	if m.Partial {
+		t.Errorf("message should not be flagged as partial")
+	}
+}
+
+func TestKeepPreamble(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "multipart-preamble.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	data := []struct {
+		Opts     []Option
+		Preamble string
+		Epilog   string
+	}{
+		{},
+		{
+			Opts:     []Option{KeepPreamble()},
+			Preamble: "This is a multi-part message in MIME format.\nPassword for the attachment: foobar\n\n",
+			Epilog:   "Sent from a malformed client.\n",
+		},
+	}
+	for _, d := range data {
+		scan := NewScanner(bytes.NewReader(src), d.Opts...)
+		if !scan.Scan() {
+			t.Fatalf("fail to parse mbox: %s", scan.Err())
+		}
+		m := scan.Message()
+		if len(m.Parts) != 2 {
+			t.Errorf("wrong number of parts! want %d, got %d", 2, len(m.Parts))
+		}
+		if got := string(m.Preamble); got != d.Preamble {
+			t.Errorf("preamble mismatched! want %q, got %q", d.Preamble, got)
+		}
+		if got := string(m.Epilog); got != d.Epilog {
+			t.Errorf("epilog mismatched! want %q, got %q", d.Epilog, got)
+		}
+		if !scan.Scan() {
+			t.Fatalf("fail to parse next message: %s", scan.Err())
+		}
+		if m := scan.Message(); m.MessageID() != "5437@local.foobar.org" || m.Preamble != nil || m.Epilog != nil {
+			t.Errorf("next message mismatched! got %s", m.MessageID())
+		}
+	}
+}
+
+func TestSloppyFromLine(t *testing.T) {
+	data := []struct {
+		Opts []Option
+		Want []string
+	}{
+		{
+			Opts: []Option{SloppyFromLine()},
+			Want: []string{"1@local.foobar.org", "2@local.foobar.org", "3@local.foobar.org"},
+		},
+		{
+			Opts: []Option{StrictFromLine()},
+			Want: []string{"1@local.foobar.org", "2@local.foobar.org"},
+		},
+	}
+	for _, d := range data {
+		r, err := os.Open(filepath.Join("testdata", "sloppy.txt"))
+		if err != nil {
+			t.Fatalf("fail to open testdata: %s", err)
+		}
+		var (
+			scan = NewScanner(r, d.Opts...)
+			ids  []string
+		)
+		for scan.Scan() {
+			m := scan.Message()
+			if body := m.TextBody(); !strings.HasPrefix(body, "From") {
+				t.Errorf("%s: body should start with a From line! got %q", m.MessageID(), body)
+			}
+			ids = append(ids, m.MessageID())
+		}
+		r.Close()
+		if err := scan.Err(); err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if strings.Join(ids, ",") != strings.Join(d.Want, ",") {
+			t.Errorf("messages mismatched! want %v, got %v", d.Want, ids)
+		}
+	}
+}
+
+func TestWithObserver(t *testing.T) {
+	for _, f := range []string{"dupes.txt", "mboxcl.txt", "crlf.txt"} {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		var (
+			stats   []Stat
+			offsets []int64
+			size    int64
+			scan    = NewScanner(bytes.NewReader(bs), WithObserver(func(s Stat) {
+				stats = append(stats, s)
+			}))
+		)
+		for scan.Scan() {
+			offsets = append(offsets, scan.Offset())
+			if len(stats) != len(offsets) {
+				t.Fatalf("%s: observer not called! want %d, got %d", f, len(offsets), len(stats))
+			}
+			s := stats[len(stats)-1]
+			if s.Offset != scan.Offset() {
+				t.Errorf("%s: wrong offset! want %d, got %d", f, scan.Offset(), s.Offset)
+			}
+			if s.Parts != len(scan.Message().Parts) {
+				t.Errorf("%s: wrong number of parts! want %d, got %d", f, len(scan.Message().Parts), s.Parts)
+			}
+			size += s.Size
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", f, err)
+		}
+		if len(stats) != len(offsets) {
+			t.Errorf("%s: observer called at end of mailbox", f)
+		}
+		if size != int64(len(bs)) {
+			t.Errorf("%s: wrong size! want %d, got %d", f, len(bs), size)
+		}
+	}
+}
+
+func TestKeepRawHeader(t *testing.T) {
+	for _, f := range []string{"simple.txt", "mixedalt.txt", "mixedalt-crlf.txt", "crlf.txt"} {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		scan := NewScanner(bytes.NewReader(bs), KeepRaw(), KeepRawHeader())
+		for scan.Scan() {
+			m := scan.Message()
+			if len(m.RawHeader) == 0 {
+				t.Errorf("%s: raw header not captured", f)
+				continue
+			}
+			if !bytes.HasPrefix(m.Raw, m.RawHeader) {
+				t.Errorf("%s: raw header mismatched! want %q, got %q", f, m.Raw[:len(m.RawHeader)], m.RawHeader)
+			}
+			if !bytes.HasSuffix(m.RawHeader, []byte("\n\n")) && !bytes.HasSuffix(m.RawHeader, []byte("\r\n\r\n")) {
+				t.Errorf("%s: raw header should end with a blank line: %q", f, m.RawHeader)
+			}
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatalf("%s: unexpected error: %s", f, err)
+		}
+	}
+	m, err := openMessage("simple.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if m.RawHeader != nil {
+		t.Errorf("raw header captured without KeepRawHeader")
+	}
+}
@@ -0,0 +1,107 @@
+package mbox
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	IssueUnknownCharset     = "unknown charset"
+	IssueUnsupportedCharset = "unsupported charset"
+	IssueUnknownEncoding    = "unknown transfer encoding"
+	IssueInvalidEncoding    = "invalid encoded body"
+	IssueMissingFilename    = "attachment without filename"
+	IssueBoundary           = "boundary mismatch"
+)
+
+type Issue struct {
+	Path    string
+	Problem string
+	Detail  string
+}
+
+func (i Issue) String() string {
+	path := i.Path
+	if path == "" {
+		path = "message"
+	}
+	if i.Detail == "" {
+		return fmt.Sprintf("%s: %s", path, i.Problem)
+	}
+	return fmt.Sprintf("%s: %s (%s)", path, i.Problem, i.Detail)
+}
+
+func (m Message) QualityReport() []Issue {
+	var list []Issue
+	if mt, ok := m.declaredMultipart(); ok {
+		if !mt.hasBoundary() || len(m.Parts) == 0 || m.unterminated {
+			list = append(list, Issue{Problem: IssueBoundary, Detail: mt.Params[multiBound]})
+		}
+	}
+	for _, p := range m.bodyParts() {
+		list = append(list, p.issues()...)
+	}
+	return list
+}
+
+func (p Part) issues() []Issue {
+	var list []Issue
+	switch enc := p.encoding(); enc {
+	case "", encBit8, encBinary:
+	case encBit7, encBase64, encQuoted:
+		if _, err := p.decode(); err != nil {
+			list = append(list, Issue{Path: p.path, Problem: IssueInvalidEncoding, Detail: err.Error()})
+		}
+	default:
+		list = append(list, Issue{Path: p.path, Problem: IssueUnknownEncoding, Detail: enc})
+	}
+	if mt, err := p.mediaType(); err == nil && mt.MainType == "text" {
+		charset := mt.Params["charset"]
+		if _, err := decodeCharset(charset, nil); err != nil {
+			problem := IssueUnknownCharset
+			if registeredCharset(charset) {
+				problem = IssueUnsupportedCharset
+			}
+			list = append(list, Issue{Path: p.path, Problem: problem, Detail: charset})
+		}
+	}
+	if p.IsAttachment() && p.Filename() == "" {
+		list = append(list, Issue{Path: p.path, Problem: IssueMissingFilename})
+	}
+	return list
+}
+
+const hdrContentID = "Content-Id"
+
+var cidReference = regexp.MustCompile(`(?i)cid:([^"'\s<>()]+)`)
+
+// MissingCIDs returns the cid: references found in the HTML bodies of the
+// message that do not match the Content-ID of any of its parts.
+func (m Message) MissingCIDs() []string {
+	ids := make(map[string]struct{})
+	for _, p := range m.Parts {
+		if id := strings.Trim(p.Get(hdrContentID), "<> "); id != "" {
+			ids[id] = struct{}{}
+		}
+	}
+	var list []string
+	for _, p := range m.bodyParts() {
+		if main, sub := p.ContentType(); main != "text" || sub != "html" || p.IsAttachment() {
+			continue
+		}
+		for _, match := range cidReference.FindAllStringSubmatch(p.TextString(), -1) {
+			id := match[1]
+			if str, err := url.PathUnescape(id); err == nil {
+				id = str
+			}
+			if _, ok := ids[id]; ok {
+				continue
+			}
+			ids[id] = struct{}{}
+			list = append(list, id)
+		}
+	}
+	return list
+}
@@ -0,0 +1,101 @@
+package mbox
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQualityReport(t *testing.T) {
+	m, err := openMessage("broken.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := []Issue{
+		{Path: "1", Problem: IssueUnknownCharset},
+		{Path: "2.1", Problem: IssueInvalidEncoding},
+		{Path: "2.2", Problem: IssueUnknownEncoding},
+		{Path: "3", Problem: IssueMissingFilename},
+	}
+	got := m.QualityReport()
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of issues! want %d, got %d (%v)", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Path != want[i].Path || got[i].Problem != want[i].Problem {
+			t.Errorf("wrong issue! want %s, got %s", want[i], got[i])
+		}
+	}
+
+	for _, f := range []string{"simple.txt", "alternative.txt", "html.txt"} {
+		m, err := openMessage(f)
+		if err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", f, err)
+		}
+		if got := m.QualityReport(); len(got) != 0 {
+			t.Errorf("%s: unexpected issues: %v", f, got)
+		}
+	}
+}
+
+func TestQualityReportUnterminated(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "unterminated.txt"))
+	if err != nil {
+		t.Fatalf("fail to open mbox: %s", err)
+	}
+	defer r.Close()
+
+	m, _ := ReadMessage(bufio.NewReader(r), Lenient())
+	if len(m.Parts) == 0 {
+		t.Fatalf("parts should have been salvaged")
+	}
+	got := m.QualityReport()
+	if len(got) == 0 || got[0].Path != "" || got[0].Problem != IssueBoundary {
+		t.Errorf("wrong issues! want %s, got %v", IssueBoundary, got)
+	}
+}
+
+func TestQualityReportCharset(t *testing.T) {
+	data := []struct {
+		Charset string
+		Problem string
+	}{
+		{Charset: "utf-8"},
+		{Charset: "ISO-8859-1"},
+		{Charset: "koi8-r", Problem: IssueUnsupportedCharset},
+		{Charset: "Shift_JIS", Problem: IssueUnsupportedCharset},
+		{Charset: "x-klingon", Problem: IssueUnknownCharset},
+	}
+	for _, d := range data {
+		p := Part{Header: make(Header)}
+		p.Set("content-type", "text/plain; charset="+d.Charset)
+		var got string
+		if list := p.issues(); len(list) > 0 {
+			got = list[0].Problem
+		}
+		if got != d.Problem {
+			t.Errorf("%s: wrong issue! want %q, got %q", d.Charset, d.Problem, got)
+		}
+	}
+}
+
+func TestMissingCIDs(t *testing.T) {
+	data := []struct {
+		File string
+		Want []string
+	}{
+		{File: "cids.txt", Want: []string{"missing@foobar.org", "background@foobar.org"}},
+		{File: "html.txt"},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if got := m.MissingCIDs(); !reflect.DeepEqual(got, d.Want) {
+			t.Errorf("%s: missing cids mismatched! want %v, got %v", d.File, d.Want, got)
+		}
+	}
+}
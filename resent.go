@@ -0,0 +1,45 @@
+package mbox
+
+import (
+	"time"
+)
+
+const (
+	hdrResentDate   = "Resent-Date"
+	hdrResentFrom   = "Resent-From"
+	hdrResentSender = "Resent-Sender"
+)
+
+// IsResent reports whether the message has been redistributed, that is if it
+// has at least one block of Resent-* fields.
+func (m Message) IsResent() bool {
+	return m.Has(hdrResentDate) || m.Has(hdrResentFrom)
+}
+
+// EffectiveDate returns the date of the most recent redistribution of the
+// message, given by the Resent-Date of the topmost Resent block, or the date
+// of the message when it has not been resent.
+func (m Message) EffectiveDate() time.Time {
+	if vs := m.Values(hdrResentDate); len(vs) > 0 {
+		if when, err := parseDate(vs[0]); err == nil {
+			return when.UTC()
+		}
+	}
+	return m.Date()
+}
+
+// EffectiveFrom returns the author of the most recent redistribution of the
+// message, given by the Resent-From, or Resent-Sender, of the topmost Resent
+// block, or the author of the message when it has not been resent.
+func (m Message) EffectiveFrom() Address {
+	for _, k := range []string{hdrResentFrom, hdrResentSender, hdrFrom} {
+		vs := m.Values(k)
+		if len(vs) == 0 {
+			continue
+		}
+		if as, _ := parseAddresses(vs[0]); len(as) > 0 {
+			return as[0]
+		}
+	}
+	return Address{}
+}
@@ -0,0 +1,42 @@
+package mbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResent(t *testing.T) {
+	data := []struct {
+		File   string
+		Resent bool
+		Date   time.Time
+		From   string
+	}{
+		{
+			File:   "resent.txt",
+			Resent: true,
+			Date:   time.Date(2020, 1, 24, 9, 0, 0, 0, time.UTC),
+			From:   "carol@foobar.org",
+		},
+		{
+			File: "simple.txt",
+			Date: time.Date(2020, 1, 22, 9, 15, 0, 0, time.UTC),
+			From: "midbel@foobar.org",
+		},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", d.File, err)
+		}
+		if got := m.IsResent(); got != d.Resent {
+			t.Errorf("%s: resent mismatched! want %t, got %t", d.File, d.Resent, got)
+		}
+		if got := m.EffectiveDate(); !got.Equal(d.Date) {
+			t.Errorf("%s: wrong date! want %s, got %s", d.File, d.Date, got)
+		}
+		if got := m.EffectiveFrom(); got.Addr != d.From {
+			t.Errorf("%s: wrong from! want %s, got %s", d.File, d.From, got)
+		}
+	}
+}
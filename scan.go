@@ -0,0 +1,196 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+)
+
+type Scanner struct {
+	ctx  context.Context
+	rs   *bufio.Reader
+	opts []Option
+
+	msg Message
+	err error
+
+	start  int64
+	offset int64
+	lines  int
+}
+
+func NewScanner(r io.Reader, opts ...Option) *Scanner {
+	return NewScannerContext(context.Background(), r, opts...)
+}
+
+func NewScannerContext(ctx context.Context, r io.Reader, opts ...Option) *Scanner {
+	rs, ok := r.(*bufio.Reader)
+	if !ok {
+		rs = bufio.NewReader(r)
+	}
+	return &Scanner{
+		ctx:  ctx,
+		rs:   rs,
+		opts: opts,
+	}
+}
+
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	r := newReader(s.ctx, s.opts...)
+	r.offset, r.lines = s.offset, s.lines
+	s.msg, s.err = r.read(s.rs)
+	s.start, s.offset, s.lines = r.fromOffset, r.offset, r.lines
+	return s.err == nil
+}
+
+func (s *Scanner) Message() Message {
+	return s.msg
+}
+
+// Offset returns the offset, from the start of the reader given to the
+// Scanner, of the From line of the current message.
+func (s *Scanner) Offset() int64 {
+	return s.start
+}
+
+func (s *Scanner) Err() error {
+	if errors.Is(s.err, io.EOF) {
+		return nil
+	}
+	return s.err
+}
+
+// Index returns the offsets of the From lines of the messages of rs. The
+// messages are fully parsed to locate them, so that the From lines found in
+// their bodies, or covered by their Content-Length, are not reported.
+func Index(rs io.ReadSeeker, opts ...Option) ([]int64, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var (
+		scan = NewScanner(rs, opts...)
+		list []int64
+	)
+	for scan.Scan() {
+		list = append(list, scan.Offset())
+	}
+	return list, scan.Err()
+}
+
+// ReadMessageAt reads the message starting at offset, as returned by Index.
+func ReadMessageAt(rs io.ReadSeeker, offset int64, opts ...Option) (Message, error) {
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return Message{}, err
+	}
+	return ReadMessage(bufio.NewReader(rs), opts...)
+}
+
+// RawScanner reads the messages of a mailbox without parsing them. Each
+// message is given as an io.Reader over its bytes, without its From line, as
+// Message.Raw would be with KeepRaw.
+type RawScanner struct {
+	rs  *bufio.Reader
+	r   *reader
+	msg *rawMessage
+	err error
+
+	fromLine string
+}
+
+// SplitReader returns a RawScanner reading the messages of r. Only the options
+// affecting how messages are separated, Lenient and StrictFromLine, are used.
+// Since headers are not parsed, the Content-Length of the messages is ignored
+// and StrictFromLine should be used to not split messages on unescaped From
+// lines of their bodies.
+func SplitReader(r io.Reader, opts ...Option) *RawScanner {
+	rs, ok := r.(*bufio.Reader)
+	if !ok {
+		rs = bufio.NewReader(r)
+	}
+	rd := newReader(context.Background(), opts...)
+	rd.src = rs
+	return &RawScanner{
+		rs: rs,
+		r:  rd,
+	}
+}
+
+// Scan advances to the next message. The remaining bytes of the previous
+// message are discarded.
+func (s *RawScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.msg != nil {
+		if _, s.err = io.Copy(io.Discard, s.msg); s.err != nil {
+			return false
+		}
+		s.msg = nil
+	}
+	s.fromLine, s.err = s.r.readFromLine(s.rs)
+	if s.err != nil {
+		return false
+	}
+	s.msg = &rawMessage{
+		rs:  s.rs,
+		r:   s.r,
+		bol: true,
+	}
+	return true
+}
+
+func (s *RawScanner) FromLine() string {
+	return s.fromLine
+}
+
+func (s *RawScanner) Reader() io.Reader {
+	return s.msg
+}
+
+func (s *RawScanner) Err() error {
+	if errors.Is(s.err, io.EOF) {
+		return nil
+	}
+	return s.err
+}
+
+type rawMessage struct {
+	rs   *bufio.Reader
+	r    *reader
+	buf  []byte
+	rest []byte
+	bol  bool
+	err  error
+}
+
+func (m *rawMessage) Read(b []byte) (int, error) {
+	if len(m.rest) == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		if m.bol && m.r.atSeparator(m.rs) {
+			m.err = io.EOF
+			return 0, m.err
+		}
+		line, err := m.rs.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		m.r.record(m.rs, line)
+		m.err = err
+		m.bol = bytes.HasSuffix(line, []byte("\n"))
+		m.buf = append(m.buf[:0], line...)
+		m.rest = m.buf
+		if len(m.rest) == 0 {
+			return 0, m.err
+		}
+	}
+	n := copy(b, m.rest)
+	m.rest = m.rest[n:]
+	return n, nil
+}
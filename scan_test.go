@@ -0,0 +1,258 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	var buf bytes.Buffer
+	for _, f := range []string{"simple.txt", "mixed.txt", "reply.txt"} {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		buf.Write(bs)
+		buf.WriteString("\n")
+	}
+	var (
+		scan  = NewScanner(bytes.NewReader(buf.Bytes()))
+		count int
+	)
+	for scan.Scan() {
+		if got := scan.Message().Subject(); got != defaultSubject {
+			t.Errorf("wrong subject header! want %s, got %s", defaultSubject, got)
+		}
+		count++
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if count != 3 {
+		t.Errorf("wrong number of messages! want %d, got %d", 3, count)
+	}
+}
+
+func TestScannerContext(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "mixed.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	scan := NewScannerContext(ctx, bytes.NewReader(bs))
+	if scan.Scan() {
+		t.Fatalf("scanner should stop when context is cancelled")
+	}
+	if err := scan.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error! want %s, got %v", context.Canceled, err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "badheader.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	scan := NewScanner(bytes.NewReader(bs))
+	for scan.Scan() {
+	}
+	var pe *ParseError
+	if err := scan.Err(); !errors.As(err, &pe) {
+		t.Fatalf("unexpected error! want ParseError, got %v", err)
+	}
+	if pe.Line != 15 {
+		t.Errorf("wrong line! want %d, got %d", 15, pe.Line)
+	}
+	if want := int64(bytes.Index(bs, []byte("this line"))); pe.Offset != want {
+		t.Errorf("wrong offset! want %d, got %d", want, pe.Offset)
+	}
+
+	_, err = ReadMessage(bufio.NewReader(strings.NewReader("Subject: mbox test\n")))
+	if !errors.As(err, &pe) || pe.Line != 1 || pe.Offset != 0 {
+		t.Errorf("unexpected error! got %v", err)
+	}
+	_, err = ReadMessage(bufio.NewReader(strings.NewReader(multipartMessage(20))), MaxParts(10))
+	if !errors.Is(err, ErrTooManyParts) || !errors.As(err, &pe) {
+		t.Errorf("unexpected error! want %s, got %v", ErrTooManyParts, err)
+	}
+}
+
+func TestParseErrorInPart(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "badpart.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	scan := NewScanner(bytes.NewReader(bs))
+	var n int
+	for ; scan.Scan(); n++ {
+	}
+	if n != 0 {
+		t.Errorf("wrong number of messages! want 0, got %d", n)
+	}
+	var pe *ParseError
+	if err := scan.Err(); !errors.As(err, &pe) {
+		t.Fatalf("unexpected error! want ParseError, got %v", err)
+	}
+	if pe.Line != 11 {
+		t.Errorf("wrong line! want %d, got %d", 11, pe.Line)
+	}
+	if want := int64(bytes.Index(bs, []byte("this line"))); pe.Offset != want {
+		t.Errorf("wrong offset! want %d, got %d", want, pe.Offset)
+	}
+}
+
+func TestMissingOpeningDelimiter(t *testing.T) {
+	bs, err := os.ReadFile(filepath.Join("testdata", "nodelimiter.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	scan := NewScanner(bytes.NewReader(bs))
+	for scan.Scan() {
+		t.Errorf("unexpected message: %s", scan.Message().Subject())
+	}
+	var pe *ParseError
+	if err := scan.Err(); !errors.Is(err, ErrBoundaryMismatch) || !errors.As(err, &pe) {
+		t.Fatalf("unexpected error! want %s, got %v", ErrBoundaryMismatch, err)
+	}
+
+	var subjects []string
+	scan = NewScanner(bytes.NewReader(bs), Lenient())
+	for scan.Scan() {
+		m := scan.Message()
+		if m.IsMultipart() && len(m.Parts) != 0 {
+			t.Errorf("%s: unexpected parts: %d", m.Subject(), len(m.Parts))
+		}
+		subjects = append(subjects, m.Subject())
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to scan mbox: %s", err)
+	}
+	if want := "mbox test,next message"; strings.Join(subjects, ",") != want {
+		t.Errorf("wrong messages! want %s, got %s", want, strings.Join(subjects, ","))
+	}
+}
+
+func TestSplitReader(t *testing.T) {
+	data := []struct {
+		File string
+		Opts []Option
+	}{
+		{File: "dupes.txt"},
+		{File: "mixedalt-crlf.txt"},
+		{File: "crlf.txt", Opts: []Option{StrictFromLine()}},
+		{File: "prose.txt", Opts: []Option{StrictFromLine()}},
+	}
+	for _, d := range data {
+		src, err := os.ReadFile(filepath.Join("testdata", d.File))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", d.File, err)
+		}
+		var (
+			scan = NewScanner(bytes.NewReader(src), append(d.Opts, KeepRaw())...)
+			raw  = SplitReader(bytes.NewReader(src), d.Opts...)
+		)
+		for scan.Scan() {
+			if !raw.Scan() {
+				t.Fatalf("%s: missing message: %v", d.File, raw.Err())
+			}
+			m := scan.Message()
+			if raw.FromLine() != m.FromLine {
+				t.Errorf("%s: From line mismatched! want %s, got %s", d.File, m.FromLine, raw.FromLine())
+			}
+			got, err := io.ReadAll(raw.Reader())
+			if err != nil {
+				t.Fatalf("%s: fail to read message: %s", d.File, err)
+			}
+			if !bytes.Equal(got, m.Raw) {
+				t.Errorf("%s: message mismatched! want %q, got %q", d.File, m.Raw, got)
+			}
+		}
+		if raw.Scan() || raw.Err() != nil {
+			t.Errorf("%s: unexpected message or error: %v", d.File, raw.Err())
+		}
+	}
+}
+
+func TestSplitReaderSkip(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "dupes.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	var (
+		raw = SplitReader(bytes.NewReader(src))
+		ids []string
+	)
+	for raw.Scan() {
+		m, err := ReadMessage(bufio.NewReader(io.MultiReader(strings.NewReader(raw.FromLine()+"\n"), raw.Reader())))
+		if err != nil {
+			t.Fatalf("fail to parse message: %s", err)
+		}
+		ids = append(ids, m.MessageID())
+	}
+	if err := raw.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"1234@local.foobar.org", "1234@local.foobar.org", "5678@local.foobar.org"}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("messages mismatched! want %v, got %v", want, ids)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	data := []struct {
+		File string
+		Opts []Option
+	}{
+		{File: "dupes.txt"},
+		{File: "mboxcl.txt"},
+		{File: "crlf.txt"},
+		{File: "preamble.txt", Opts: []Option{Lenient()}},
+		{File: "prose.txt", Opts: []Option{StrictFromLine()}},
+	}
+	for _, d := range data {
+		src, err := os.ReadFile(filepath.Join("testdata", d.File))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", d.File, err)
+		}
+		var (
+			rs   = bytes.NewReader(src)
+			scan = NewScanner(bytes.NewReader(src), d.Opts...)
+			ms   []Message
+		)
+		for scan.Scan() {
+			ms = append(ms, scan.Message())
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", d.File, err)
+		}
+		rs.Seek(10, io.SeekStart)
+		index, err := Index(rs, d.Opts...)
+		if err != nil {
+			t.Fatalf("%s: fail to index mbox: %s", d.File, err)
+		}
+		if len(index) != len(ms) {
+			t.Fatalf("%s: wrong number of messages! want %d, got %d", d.File, len(ms), len(index))
+		}
+		for i := len(index) - 1; i >= 0; i-- {
+			if !bytes.HasPrefix(src[index[i]:], []byte(ms[i].FromLine)) {
+				t.Errorf("%s: offset %d does not point to a From line", d.File, index[i])
+			}
+			m, err := ReadMessageAt(rs, index[i], d.Opts...)
+			if err != nil {
+				t.Fatalf("%s: fail to read message at %d: %s", d.File, index[i], err)
+			}
+			if m.MessageID() != ms[i].MessageID() || m.TextBody() != ms[i].TextBody() {
+				t.Errorf("%s: message at %d mismatched! want %s, got %s", d.File, index[i], ms[i].MessageID(), m.MessageID())
+			}
+		}
+	}
+}
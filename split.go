@@ -0,0 +1,123 @@
+package mbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// maxSplitField is the maximum length in bytes of the fields used in the names
+// of the files written by Split, so that the names stay under the NAME_MAX
+// limit of most filesystems.
+const maxSplitField = 100
+
+type splitName struct {
+	Index     int
+	Date      string
+	Subject   string
+	MessageID string
+}
+
+// Split writes each message read from r in its own file. The name of the
+// files is given by pattern, a text/template executed with the following
+// fields, sanitized to be usable in a filename:
+//
+//   - Index: the 1-based position of the message in r,
+//   - Date: the date of the message (YYYY-MM-DD),
+//   - Subject: the decoded subject of the message,
+//   - MessageID: the Message-Id of the message without its angle brackets.
+//
+// Subject and MessageID are truncated to 100 bytes and replaced by the Index
+// when they are empty once sanitized.
+//
+// For example: "out/{{.Date}}-{{.Subject}}.eml". A -N suffix is added to the
+// name when the file already exists. The files contain the original bytes
+// of the messages, without their From line. Split returns the paths of the
+// files written.
+func Split(r io.Reader, pattern string) ([]string, error) {
+	tpl, err := template.New("split").Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		scan  = NewScanner(r, KeepRaw())
+		files []string
+	)
+	for scan.Scan() {
+		m := scan.Message()
+		file, err := splitFile(tpl, len(files)+1, m)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, scan.Err()
+}
+
+func splitFile(tpl *template.Template, index int, m Message) (string, error) {
+	data := splitName{
+		Index:     index,
+		Subject:   splitField(decodeWords(m.Subject()), index),
+		MessageID: splitField(m.MessageID(), index),
+	}
+	if when := m.Date(); !when.IsZero() {
+		data.Date = when.Format("2006-01-02")
+	}
+	var name strings.Builder
+	if err := tpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+	file := name.String()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", err
+	}
+	w, file, err := createUnique(file)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(m.Raw); err != nil {
+		w.Close()
+		return file, err
+	}
+	return file, w.Close()
+}
+
+func splitField(str string, index int) string {
+	str = sanitizeName(str)
+	if len(str) > maxSplitField {
+		n := maxSplitField
+		for n > 0 && !utf8.RuneStart(str[n]) {
+			n--
+		}
+		str = strings.TrimRight(str[:n], ". ")
+	}
+	if str == "" {
+		return strconv.Itoa(index)
+	}
+	return str
+}
+
+func createUnique(file string) (*os.File, string, error) {
+	var (
+		ext  = filepath.Ext(file)
+		base = strings.TrimSuffix(file, ext)
+		name = file
+	)
+	for i := 1; ; i++ {
+		w, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			return w, name, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, "", err
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
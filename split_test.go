@@ -0,0 +1,96 @@
+package mbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "dupes.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	var (
+		dir     = t.TempDir()
+		pattern = filepath.Join(dir, "{{.Date}}", "{{.Subject}}-{{.MessageID}}.eml")
+	)
+	files, err := Split(bytes.NewReader(src), pattern)
+	if err != nil {
+		t.Fatalf("fail to split mbox: %s", err)
+	}
+	want := []string{
+		filepath.Join(dir, "2020-01-22", "mbox test-1234@local.foobar.org.eml"),
+		filepath.Join(dir, "2020-01-22", "mbox test-1234@local.foobar.org-1.eml"),
+		filepath.Join(dir, "2020-01-22", "mbox test-5678@local.foobar.org.eml"),
+	}
+	if len(files) != len(want) {
+		t.Fatalf("wrong number of files! want %d, got %d", len(want), len(files))
+	}
+	var all []byte
+	for i, f := range files {
+		if f != want[i] {
+			t.Errorf("wrong filename! want %s, got %s", want[i], f)
+		}
+		bs, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		if bytes.HasPrefix(bs, []byte(fromLinePrefix)) {
+			t.Errorf("%s: From line should not be written", f)
+		}
+		if !bytes.Contains(src, bs) {
+			t.Errorf("%s: content does not match the original message", f)
+		}
+		all = append(all, bs...)
+	}
+	if len(all)+3*len("From midbel@foobar.org Wed Jan 22 11:15:00 2020\n") != len(src) {
+		t.Errorf("written bytes mismatched! want %d, got %d", len(src), len(all))
+	}
+}
+
+func TestSplitSanitize(t *testing.T) {
+	msg := "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: =?utf-8?q?../../etc/passwd_*?=\n\n" +
+		"hello\n"
+	dir := t.TempDir()
+	files, err := Split(bytes.NewReader([]byte(msg)), filepath.Join(dir, "{{.Index}}-{{.Subject}}.eml"))
+	if err != nil {
+		t.Fatalf("fail to split mbox: %s", err)
+	}
+	if want := filepath.Join(dir, "1-_.._etc_passwd _.eml"); len(files) != 1 || files[0] != want {
+		t.Errorf("wrong filename! want %s, got %v", want, files)
+	}
+}
+
+func TestSplitLongSubject(t *testing.T) {
+	subject := "a" + strings.Repeat("é", 200)
+	msg := "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: " + subject + "\n\n" +
+		"hello\n" +
+		"From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: ...\n\n" +
+		"hello\n"
+	dir := t.TempDir()
+	files, err := Split(bytes.NewReader([]byte(msg)), filepath.Join(dir, "{{.Subject}}.eml"))
+	if err != nil {
+		t.Fatalf("fail to split mbox: %s", err)
+	}
+	want := []string{
+		filepath.Join(dir, "a"+strings.Repeat("é", maxSplitField/2-1)+".eml"),
+		filepath.Join(dir, "2.eml"),
+	}
+	if len(files) != len(want) {
+		t.Fatalf("wrong number of files! want %d, got %d", len(want), len(files))
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("wrong filename! want %s, got %s", want[i], files[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package mbox
+
+import (
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+type Stats struct {
+	Count           int
+	WithAttachments int
+	Replies         int
+	AttachmentBytes int
+	First           time.Time
+	Last            time.Time
+	Senders         map[string]int
+}
+
+func Aggregate(scan *Scanner) (Stats, error) {
+	var s Stats
+	for scan.Scan() {
+		s.Add(scan.Message())
+	}
+	return s, scan.Err()
+}
+
+func (s *Stats) Add(m Message) {
+	if s.Senders == nil {
+		s.Senders = make(map[string]int)
+	}
+	s.Count++
+	if m.IsReply() {
+		s.Replies++
+	}
+	if m.HasAttachments() {
+		s.WithAttachments++
+	}
+	for _, p := range m.Parts {
+		if p.IsAttachment() {
+			s.AttachmentBytes += len(p.Bytes())
+		}
+	}
+	if from := strings.ToLower(m.From()); from != "" {
+		s.Senders[from]++
+	}
+	when := m.Date()
+	if when.IsZero() {
+		return
+	}
+	if s.First.IsZero() || when.Before(s.First) {
+		s.First = when
+	}
+	if s.Last.IsZero() || when.After(s.Last) {
+		s.Last = when
+	}
+}
+
+type Usage struct {
+	Count int
+	Bytes int
+}
+
+type Report struct {
+	Usage
+	Types      map[string]Usage
+	Extensions map[string]Usage
+}
+
+// AttachmentReport reads all the messages of r and reports the number and the
+// decoded size of their attachments, in total and broken down by media type
+// and by filename extension. Attachments without extension are counted under
+// the empty string.
+func AttachmentReport(r io.Reader) (Report, error) {
+	rp := Report{
+		Types:      make(map[string]Usage),
+		Extensions: make(map[string]Usage),
+	}
+	scan := NewScanner(r)
+	for scan.Scan() {
+		for _, p := range scan.Message().bodyParts() {
+			if !p.IsAttachment() {
+				continue
+			}
+			size := p.Size()
+			rp.Usage = rp.Usage.add(size)
+
+			mt := p.SniffedType()
+			rp.Types[mt] = rp.Types[mt].add(size)
+
+			ext := strings.ToLower(path.Ext(p.Filename()))
+			rp.Extensions[ext] = rp.Extensions[ext].add(size)
+		}
+	}
+	return rp, scan.Err()
+}
+
+func (u Usage) add(size int) Usage {
+	u.Count++
+	u.Bytes += size
+	return u
+}
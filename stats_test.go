@@ -0,0 +1,110 @@
+package mbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	var buf bytes.Buffer
+	for _, f := range []string{"simple.txt", "mixed.txt", "reply.txt", "date-nocomma.txt", "recipients.txt"} {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		buf.Write(bs)
+		buf.WriteString("\n")
+	}
+	s, err := Aggregate(NewScanner(&buf))
+	if err != nil {
+		t.Fatalf("fail to aggregate messages: %s", err)
+	}
+	if s.Count != 5 {
+		t.Errorf("wrong number of messages! want %d, got %d", 5, s.Count)
+	}
+	if s.Replies != 1 {
+		t.Errorf("wrong number of replies! want %d, got %d", 1, s.Replies)
+	}
+	if s.WithAttachments != 1 {
+		t.Errorf("wrong number of messages with attachments! want %d, got %d", 1, s.WithAttachments)
+	}
+	if s.AttachmentBytes == 0 {
+		t.Errorf("attachment bytes should be counted")
+	}
+	if len(s.Senders) != 1 || s.Senders["midbel@foobar.org"] != 5 {
+		t.Errorf("wrong senders: %v", s.Senders)
+	}
+	if want := time.Date(2020, 1, 2, 9, 15, 0, 0, time.UTC); !s.First.Equal(want) {
+		t.Errorf("wrong first date! want %s, got %s", want, s.First)
+	}
+	if want := time.Date(2020, 1, 22, 9, 15, 0, 0, time.UTC); !s.Last.Equal(want) {
+		t.Errorf("wrong last date! want %s, got %s", want, s.Last)
+	}
+}
+
+func TestAttachmentReport(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		files = []string{"simple.txt", "mixed.txt", "attachonly.txt", "filenames.txt", "gzip.txt"}
+		total int
+	)
+	for _, f := range files {
+		bs, err := os.ReadFile(filepath.Join("testdata", f))
+		if err != nil {
+			t.Fatalf("fail to read %s: %s", f, err)
+		}
+		buf.Write(bs)
+		buf.WriteString("\n")
+
+		m, err := openMessage(f)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		for _, p := range m.bodyParts() {
+			if p.IsAttachment() {
+				total += len(p.Bytes())
+			}
+		}
+	}
+	rp, err := AttachmentReport(&buf)
+	if err != nil {
+		t.Fatalf("fail to build report: %s", err)
+	}
+	if rp.Count != 4 {
+		t.Errorf("wrong number of attachments! want %d, got %d", 4, rp.Count)
+	}
+	if rp.Bytes != total {
+		t.Errorf("wrong attachment bytes! want %d, got %d", total, rp.Bytes)
+	}
+	types := map[string]int{
+		"text/html":                1,
+		"text/plain":               1,
+		"application/pdf":          1,
+		"application/octet-stream": 1,
+	}
+	for k, c := range types {
+		if got := rp.Types[k].Count; got != c {
+			t.Errorf("%s: wrong count! want %d, got %d", k, c, got)
+		}
+	}
+	exts := map[string]int{
+		".go":  2,
+		".txt": 1,
+		".bin": 1,
+	}
+	for k, c := range exts {
+		if got := rp.Extensions[k].Count; got != c {
+			t.Errorf("%s: wrong count! want %d, got %d", k, c, got)
+		}
+	}
+	var sum int
+	for _, u := range rp.Extensions {
+		sum += u.Bytes
+	}
+	if sum != total {
+		t.Errorf("wrong extension bytes! want %d, got %d", total, sum)
+	}
+}
@@ -0,0 +1,136 @@
+package mbox
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Summary struct {
+	MessageID   string              `json:"message-id,omitempty"`
+	From        string              `json:"from"`
+	To          []string            `json:"to"`
+	Subject     string              `json:"subject"`
+	Date        string              `json:"date,omitempty"`
+	Headers     map[string][]string `json:"headers"`
+	Attachments []string            `json:"attachments"`
+	Parts       []PartSummary       `json:"parts"`
+}
+
+type PartSummary struct {
+	Type     string `json:"type"`
+	Filename string `json:"filename,omitempty"`
+	Size     int    `json:"size"`
+}
+
+func (m Message) Summary() Summary {
+	s := Summary{
+		MessageID:   m.Get(hdrMessageID),
+		From:        m.From(),
+		To:          m.To(),
+		Subject:     decodeWords(m.Subject()),
+		Headers:     make(map[string][]string),
+		Attachments: m.Files(),
+	}
+	if when := m.Date(); !when.IsZero() {
+		s.Date = when.Format(time.RFC3339)
+	}
+	for k, vs := range m.Header {
+		for _, v := range vs {
+			s.Headers[k] = append(s.Headers[k], decodeWords(v))
+		}
+	}
+	for _, p := range m.bodyParts() {
+		ps := PartSummary{
+			Type:     p.DeclaredType(),
+			Filename: p.Filename(),
+			Size:     len(p.Bytes()),
+		}
+		if ps.Type == "" {
+			ps.Type = "text/plain"
+		}
+		s.Parts = append(s.Parts, ps)
+	}
+	return s
+}
+
+func (m Message) IndexDocument() map[string]string {
+	doc := map[string]string{
+		"from":        m.From(),
+		"to":          strings.Join(m.To(), ", "),
+		"cc":          strings.Join(m.Cc(), ", "),
+		"subject":     decodeWords(m.Subject()),
+		"body":        m.TextBody(),
+		"attachments": strings.Join(m.Files(), ", "),
+	}
+	if when := m.Date(); !when.IsZero() {
+		doc["date"] = when.Format(time.RFC3339)
+	}
+	for k, v := range doc {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			delete(doc, k)
+			continue
+		}
+		doc[k] = v
+	}
+	return doc
+}
+
+var wordDecoder = mime.WordDecoder{
+	CharsetReader: func(charset string, r io.Reader) (io.Reader, error) {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		body, err = decodeCharset(charset, body)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(body), nil
+	},
+}
+
+// DecodedSubject returns the subject of the message with its RFC 2047 encoded
+// words decoded.
+func (m Message) DecodedSubject() string {
+	return decodeWords(m.Subject())
+}
+
+func decodeWords(str string) string {
+	dec, err := wordDecoder.DecodeHeader(str)
+	if err != nil {
+		return str
+	}
+	return dec
+}
+
+var encodedWord = regexp.MustCompile(`=\?([^?\s]+)\?[bBqQ]\?[^?\s]*\?=`)
+
+// SubjectCharsets returns the distinct charsets, lowercased, used by the
+// encoded words of the Subject in the order they appear.
+func (m Message) SubjectCharsets() []string {
+	return wordCharsets(m.Subject())
+}
+
+func wordCharsets(str string) []string {
+	var (
+		list []string
+		seen = make(map[string]struct{})
+	)
+	for _, match := range encodedWord.FindAllStringSubmatch(str, -1) {
+		charset := strings.ToLower(match[1])
+		if ix := strings.Index(charset, "*"); ix >= 0 {
+			charset = charset[:ix]
+		}
+		if _, ok := seen[charset]; ok || charset == "" {
+			continue
+		}
+		seen[charset] = struct{}{}
+		list = append(list, charset)
+	}
+	return list
+}
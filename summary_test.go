@@ -0,0 +1,114 @@
+package mbox
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	m, err := openMessage("encoded.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	s := m.Summary()
+	if want := "mbox test € café"; s.Subject != want {
+		t.Errorf("wrong subject! want %s, got %s", want, s.Subject)
+	}
+	if want := "Jérôme <midbel@foobar.org>"; s.Headers["From"][0] != want {
+		t.Errorf("wrong from header! want %s, got %s", want, s.Headers["From"][0])
+	}
+	if want := "2020-01-22T09:15:00Z"; s.Date != want {
+		t.Errorf("wrong date! want %s, got %s", want, s.Date)
+	}
+	if len(s.Parts) != 1 || s.Parts[0].Type != "text/plain" {
+		t.Errorf("wrong parts: %v", s.Parts)
+	}
+
+	m, err = openMessage("mixed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	bs, err := json.Marshal(m.Summary())
+	if err != nil {
+		t.Fatalf("fail to marshal summary: %s", err)
+	}
+	var other Summary
+	if err := json.Unmarshal(bs, &other); err != nil {
+		t.Fatalf("fail to unmarshal summary: %s", err)
+	}
+	if len(other.Parts) != 2 {
+		t.Fatalf("wrong number of part! want %d, got %d", 2, len(other.Parts))
+	}
+	if p := other.Parts[1]; p.Filename != "sample.go" || p.Type != "text/html" || p.Size == 0 {
+		t.Errorf("wrong attachment summary: %v", p)
+	}
+	if len(other.Attachments) != 1 || other.Attachments[0] != "sample.go" {
+		t.Errorf("wrong attachments: %v", other.Attachments)
+	}
+}
+
+func TestIndexDocument(t *testing.T) {
+	data := []struct {
+		File string
+		Want map[string]string
+	}{
+		{
+			File: "mixed.txt",
+			Want: map[string]string{
+				"from":        "midbel@foobar.org",
+				"to":          "rustine@foobar.org",
+				"subject":     "mbox test",
+				"date":        "2020-01-22T09:15:00Z",
+				"body":        "This is a message to be parsed by the library.\nSo, \"good luck\".",
+				"attachments": "sample.go",
+			},
+		},
+		{
+			File: "encoded.txt",
+			Want: map[string]string{
+				"from":    "midbel@foobar.org",
+				"to":      "rustine@foobar.org",
+				"subject": "mbox test € café",
+				"date":    "2020-01-22T09:15:00Z",
+				"body":    "This is a message to be parsed by the library.\nSo, \"good luck\".",
+			},
+		},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", d.File, err)
+			continue
+		}
+		doc := m.IndexDocument()
+		if len(doc) != len(d.Want) {
+			t.Errorf("%s: wrong number of fields! want %d, got %d (%v)", d.File, len(d.Want), len(doc), doc)
+		}
+		for k, want := range d.Want {
+			if got := doc[k]; got != want {
+				t.Errorf("%s: wrong %s field! want %q, got %q", d.File, k, want, got)
+			}
+		}
+	}
+}
+
+func TestSubjectCharsets(t *testing.T) {
+	data := []struct {
+		File string
+		Want []string
+	}{
+		{File: "simple.txt"},
+		{File: "encoded.txt", Want: []string{"utf-8", "iso-8859-1"}},
+		{File: "charsets.txt", Want: []string{"utf-8", "iso-8859-1", "koi8-r"}},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Fatalf("fail to parse mbox: %s", err)
+		}
+		if got := m.SubjectCharsets(); !reflect.DeepEqual(got, d.Want) {
+			t.Errorf("%s: charsets mismatched! want %v, got %v", d.File, d.Want, got)
+		}
+	}
+}
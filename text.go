@@ -0,0 +1,172 @@
+package mbox
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+func stripTags(str string) string {
+	var (
+		buf  strings.Builder
+		skip string
+	)
+	for len(str) > 0 {
+		ix := strings.IndexByte(str, '<')
+		if ix < 0 {
+			if skip == "" {
+				buf.WriteString(str)
+			}
+			break
+		}
+		if skip == "" {
+			buf.WriteString(str[:ix])
+		}
+		str = str[ix+1:]
+		end := strings.IndexByte(str, '>')
+		if end < 0 {
+			break
+		}
+		tag := strings.ToLower(strings.TrimSpace(str[:end]))
+		str = str[end+1:]
+		if fs := strings.Fields(tag); len(fs) > 0 {
+			tag = strings.TrimSuffix(fs[0], "/")
+		}
+		switch tag {
+		case "script", "style":
+			skip = "/" + tag
+		case skip:
+			skip = ""
+		case "br", "/p", "/div", "/li", "/tr", "/h1", "/h2", "/h3", "/h4", "/h5", "/h6":
+			if skip == "" {
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return cleanText(html.UnescapeString(buf.String()))
+}
+
+func cleanText(str string) string {
+	var (
+		lines = strings.Split(str, "\n")
+		list  = make([]string, 0, len(lines))
+		blank bool
+	)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if !blank && len(list) > 0 {
+				list = append(list, line)
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		list = append(list, line)
+	}
+	return strings.TrimSpace(strings.Join(list, "\n"))
+}
+
+const (
+	dirLTR = "ltr"
+	dirRTL = "rtl"
+)
+
+// rtlLanguages lists the primary language subtags that TextDirection considers
+// as written from right to left when found in a Content-Language header.
+var rtlLanguages = []string{"ar", "arc", "ckb", "dv", "fa", "he", "ps", "sd", "syr", "ug", "ur", "yi"}
+
+// TextDirection guesses the direction of the text of the message. It returns
+// rtl when the Content-Language header names a language written from right to
+// left (Arabic, Hebrew, Persian, Urdu,...), when the text body starts with an
+// explicit right-to-left mark or when it has more right-to-left than
+// left-to-right letters. Otherwise it returns ltr.
+func (m Message) TextDirection() string {
+	langs := []string{m.Get(hdrContentLanguage)}
+	for _, p := range m.Parts {
+		langs = append(langs, p.Get(hdrContentLanguage))
+	}
+	for _, str := range langs {
+		for _, lang := range strings.Split(str, ",") {
+			if isRTLLanguage(lang) {
+				return dirRTL
+			}
+		}
+	}
+	return textDirection(m.TextBody())
+}
+
+func isRTLLanguage(lang string) bool {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if ix := strings.IndexAny(lang, "-_"); ix >= 0 {
+		lang = lang[:ix]
+	}
+	for _, str := range rtlLanguages {
+		if str == lang {
+			return true
+		}
+	}
+	return false
+}
+
+func textDirection(str string) string {
+	var rtl, ltr int
+	for i, r := range str {
+		switch r {
+		case '\u200f', '\u202b', '\u202e', '\u2067':
+			if i == 0 {
+				return dirRTL
+			}
+		case '\u200e', '\u202a', '\u202d', '\u2066':
+			if i == 0 {
+				return dirLTR
+			}
+		}
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko) {
+			rtl++
+		} else {
+			ltr++
+		}
+	}
+	if rtl > ltr {
+		return dirRTL
+	}
+	return dirLTR
+}
+
+func unflow(str string, delsp bool) string {
+	var (
+		buf   strings.Builder
+		lines = strings.Split(str, "\n")
+		soft  bool
+		quote int
+	)
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		depth := len(line) - len(strings.TrimLeft(line, ">"))
+		line = line[depth:]
+		if strings.HasPrefix(line, " ") {
+			line = line[1:]
+		}
+		if soft && depth != quote {
+			buf.WriteString("\n")
+			soft = false
+		}
+		if !soft && depth > 0 {
+			buf.WriteString(strings.Repeat(">", depth) + " ")
+		}
+		quote = depth
+		soft = strings.HasSuffix(line, " ") && line != "-- "
+		if soft && delsp {
+			line = line[:len(line)-1]
+		}
+		buf.WriteString(line)
+		if !soft && i < len(lines)-1 {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
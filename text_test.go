@@ -0,0 +1,52 @@
+package mbox
+
+import (
+	"testing"
+)
+
+func TestTextDirection(t *testing.T) {
+	data := []struct {
+		File     string
+		Language string
+		Want     string
+	}{
+		{File: "simple.txt", Want: "ltr"},
+		{File: "rtl.txt", Want: "rtl"},
+		{File: "simple.txt", Language: "ar-EG", Want: "rtl"},
+		{File: "rtl.txt", Language: "en", Want: "rtl"},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", d.File, err)
+			continue
+		}
+		if d.Language != "" {
+			m.Set("Content-Language", d.Language)
+		}
+		if got := m.TextDirection(); got != d.Want {
+			t.Errorf("%s (%s): wrong direction! want %s, got %s", d.File, d.Language, d.Want, got)
+		}
+	}
+}
+
+func TestFlowed(t *testing.T) {
+	m, err := openMessage("flowed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	p := m.bodyParts()[0]
+	if !p.IsFlowed() {
+		t.Fatalf("part should be flowed")
+	}
+	want := "This is a message to be parsed by the library. So, \"good luck\".\n\n> This is a quoted line that was soft wrapped.\n>> Deeper quote.\nFrom the start.\n-- \nmidbel\n"
+	if got := m.TextBody(); got != want {
+		t.Errorf("wrong text body! want %q, got %q", want, got)
+	}
+
+	p.Set("content-type", "text/plain; format=flowed; delsp=yes")
+	p.Body = []byte("Some lan \nguages do not use spac \nes.\n")
+	if got, want := p.TextString(), "Some languages do not use spaces.\n"; got != want {
+		t.Errorf("wrong text with delsp! want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,150 @@
+package mbox
+
+import (
+	"regexp"
+	"strings"
+)
+
+var replyPrefixes = []string{
+	"re:",
+	"fw:",
+	"fwd:",
+	"aw:",
+	"sv:",
+	"tr:",
+}
+
+// SameThread reports whether a and b belong to the same conversation. Two
+// messages are in the same thread when:
+//
+//   - one of them references the Message-Id of the other in its References
+//     or In-Reply-To headers,
+//   - or both reference a common message,
+//   - or their subjects are equal once reply/forward prefixes (Re:, Fwd:,...),
+//     mailing list tags ([list]) and extra whitespaces are removed.
+func SameThread(a, b Message) bool {
+	var (
+		refa = threadIDs(a)
+		refb = threadIDs(b)
+	)
+	if _, ok := refb[a.MessageID()]; ok {
+		return true
+	}
+	if _, ok := refa[b.MessageID()]; ok {
+		return true
+	}
+	for id := range refa {
+		if _, ok := refb[id]; ok {
+			return true
+		}
+	}
+	sa, sb := threadSubject(a.Subject()), threadSubject(b.Subject())
+	return sa != "" && sa == sb
+}
+
+func threadIDs(m Message) map[string]struct{} {
+	ids := make(map[string]struct{})
+	for _, id := range m.References() {
+		ids[id] = struct{}{}
+	}
+	for _, id := range m.InReplyTo() {
+		ids[id] = struct{}{}
+	}
+	return ids
+}
+
+func threadSubject(str string) string {
+	str = strings.ToLower(strings.Join(strings.Fields(str), " "))
+	for {
+		prev := str
+		if strings.HasPrefix(str, "[") {
+			if ix := strings.Index(str, "]"); ix > 0 {
+				str = strings.TrimSpace(str[ix+1:])
+			}
+		}
+		for _, p := range replyPrefixes {
+			str = strings.TrimSpace(strings.TrimPrefix(str, p))
+		}
+		if str == prev {
+			break
+		}
+	}
+	return str
+}
+
+var attributionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^on\s.+\swrote\s?:$`),
+	regexp.MustCompile(`(?i)^le\s.+\sa\s[ée]crit\s?:$`),
+	regexp.MustCompile(`(?i)^am\s.+\sschrieb.*:$`),
+	regexp.MustCompile(`(?i)^el\s.+\sescribi[óo]\s?:$`),
+	regexp.MustCompile(`(?i)^il\s.+\sha\sscritto\s?:$`),
+	regexp.MustCompile(`(?i)^op\s.+\sschreef.*:$`),
+	regexp.MustCompile(`(?i)^.+\swrote\s?:$`),
+}
+
+// ReplyAttribution returns the line introducing the quoted text of a reply,
+// like "On Wed, Jan 22, 2020, midbel wrote:". Attributions wrapped over a few
+// lines are joined. An empty string is returned if none can be found.
+func (m Message) ReplyAttribution() string {
+	return replyAttribution(m.TextBody())
+}
+
+func replyAttribution(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i := range lines {
+		if !strings.HasPrefix(lines[i], ">") {
+			continue
+		}
+		var prev []string
+		for j := i - 1; j >= 0 && len(prev) < 3; j-- {
+			line := strings.TrimSpace(lines[j])
+			if line == "" {
+				if len(prev) > 0 {
+					break
+				}
+				continue
+			}
+			prev = append([]string{line}, prev...)
+		}
+		for _, re := range attributionPatterns {
+			for j := range prev {
+				if str := joinLines(prev[j:]); re.MatchString(str) {
+					return str
+				}
+			}
+		}
+		break
+	}
+	return ""
+}
+
+func joinLines(lines []string) string {
+	var str strings.Builder
+	for i, line := range lines {
+		if i > 0 && !strings.HasSuffix(lines[i-1], "<") {
+			str.WriteString(" ")
+		}
+		str.WriteString(line)
+	}
+	return str.String()
+}
+
+func parseMessageIDs(str string) []string {
+	var ids []string
+	for {
+		ix := strings.Index(str, "<")
+		if ix < 0 {
+			break
+		}
+		str = str[ix+1:]
+		ix = strings.Index(str, ">")
+		if ix < 0 {
+			break
+		}
+		if id := strings.TrimSpace(str[:ix]); id != "" {
+			ids = append(ids, id)
+		}
+		str = str[ix+1:]
+	}
+	return ids
+}
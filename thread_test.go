@@ -0,0 +1,146 @@
+package mbox
+
+import (
+	"testing"
+)
+
+func TestSameThread(t *testing.T) {
+	root, err := openMessage("simple.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	reply, err := openMessage("reply.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	reply.Set("subject", "completely different")
+
+	data := []struct {
+		A, B Message
+		Want bool
+	}{
+		{
+			A:    root,
+			B:    reply,
+			Want: true,
+		},
+		{
+			A:    reply,
+			B:    root,
+			Want: true,
+		},
+		{
+			A:    threadMessage("<a@foobar.org>", "", "lunch"),
+			B:    threadMessage("<b@foobar.org>", "", "budget"),
+			Want: false,
+		},
+		{
+			A:    threadMessage("<a@foobar.org>", "<root@foobar.org>", "lunch"),
+			B:    threadMessage("<b@foobar.org>", "<root@foobar.org> <a@foobar.org>", "budget"),
+			Want: true,
+		},
+		{
+			A:    threadMessage("<a@foobar.org>", "", "budget"),
+			B:    threadMessage("<b@foobar.org>", "", "[team] RE: Fwd:  Budget"),
+			Want: true,
+		},
+	}
+	for i, d := range data {
+		if got := SameThread(d.A, d.B); got != d.Want {
+			t.Errorf("%d: same thread mismatched! want %t, got %t", i, d.Want, got)
+		}
+	}
+}
+
+func threadMessage(id, refs, subject string) Message {
+	m := Message{Header: make(Header)}
+	m.Set("message-id", id)
+	m.Set("subject", subject)
+	if refs != "" {
+		m.Set("references", refs)
+	}
+	return m
+}
+
+func TestMessageIDs(t *testing.T) {
+	m, err := openMessage("reply.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if got := m.MessageID(); got != "4567@local.foobar.org" {
+		t.Errorf("wrong message id! want %s, got %s", "4567@local.foobar.org", got)
+	}
+	if got := m.InReplyTo(); len(got) != 1 || got[0] != "1234@local.foobar.org" {
+		t.Errorf("wrong in-reply-to: %q", got)
+	}
+	if got := m.References(); len(got) != 0 {
+		t.Errorf("unexpected references: %q", got)
+	}
+
+	m.Set("references", "<1@foobar.org>,<2@foobar.org>  <3@foobar.org>, <>")
+	want := []string{"1@foobar.org", "2@foobar.org", "3@foobar.org"}
+	got := m.References()
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of references! want %d, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("wrong reference! want %s, got %s", want[i], got[i])
+		}
+	}
+}
+
+func TestReplyAttribution(t *testing.T) {
+	m, err := openMessage("attribution.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := "On Wed, Jan 22, 2020 at 11:15 AM midbel <midbel@foobar.org> wrote:"
+	if got := m.ReplyAttribution(); got != want {
+		t.Errorf("attribution mismatched! want %s, got %s", want, got)
+	}
+	m, err = openMessage("reply.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	if got := m.ReplyAttribution(); got != "" {
+		t.Errorf("unexpected attribution: %s", got)
+	}
+
+	data := []struct {
+		Body string
+		Want string
+	}{
+		{
+			Body: "ok\n\nOn Wed, Jan 22, 2020 at 11:15 AM midbel <\nmidbel@foobar.org> wrote:\n\n> hello\n",
+			Want: "On Wed, Jan 22, 2020 at 11:15 AM midbel <midbel@foobar.org> wrote:",
+		},
+		{
+			Body: "ok\n\nLe mer. 22 janv. 2020 à 11:15, midbel <midbel@foobar.org> a écrit :\n> bonjour\n",
+			Want: "Le mer. 22 janv. 2020 à 11:15, midbel <midbel@foobar.org> a écrit :",
+		},
+		{
+			Body: "ok\r\n\r\nAm Mi., 22. Jan. 2020 um 11:15 Uhr schrieb midbel <midbel@foobar.org>:\r\n> hallo\r\n",
+			Want: "Am Mi., 22. Jan. 2020 um 11:15 Uhr schrieb midbel <midbel@foobar.org>:",
+		},
+		{
+			Body: "midbel <midbel@foobar.org> wrote:\n> hello\n",
+			Want: "midbel <midbel@foobar.org> wrote:",
+		},
+		{
+			Body: "Thanks!\nOn Wed, Jan 22, 2020, midbel wrote:\n> hello\n",
+			Want: "On Wed, Jan 22, 2020, midbel wrote:",
+		},
+		{
+			Body: "see below:\n> hello\n",
+		},
+		{
+			Body: "no quote at all\n",
+		},
+	}
+	for _, d := range data {
+		if got := replyAttribution(d.Body); got != d.Want {
+			t.Errorf("attribution mismatched! want %q, got %q", d.Want, got)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mbox
+
+import (
+	"strings"
+)
+
+const (
+	hdrAutoSubmitted = "Auto-Submitted"
+	hdrAutoReply     = "X-Autoreply"
+	hdrAutoRespond   = "X-Autorespond"
+	hdrPrecedence    = "Precedence"
+)
+
+// VacationSubjects lists the lowercase fragments that IsVacation looks for in
+// the subject of a message.
+var VacationSubjects = []string{
+	"out of office",
+	"out of the office",
+	"away from the office",
+	"on vacation",
+	"on holiday",
+	"on leave",
+	"automatic reply",
+	"auto reply",
+	"autoreply",
+	"absence",
+	"abwesenheit",
+	"absent du bureau",
+	"fuera de la oficina",
+}
+
+// IsVacation reports whether the message looks like an out of office notice.
+// The subject of the message should contain one of VacationSubjects and:
+//
+//   - the message is flagged as an automatic reply (Auto-Submitted:
+//     auto-replied, X-Autoreply, X-Autorespond or Precedence: auto_reply),
+//   - or the message has no In-Reply-To header, in which case it can not be a
+//     genuine reply in a thread.
+func (m Message) IsVacation() bool {
+	subject := strings.ToLower(decodeWords(m.Subject()))
+	for _, str := range VacationSubjects {
+		if strings.Contains(subject, str) {
+			return m.isAutoReply() || !m.IsReply()
+		}
+	}
+	return false
+}
+
+func (m Message) isAutoReply() bool {
+	if strings.HasPrefix(strings.ToLower(m.Get(hdrAutoSubmitted)), "auto-replied") {
+		return true
+	}
+	if m.Has(hdrAutoReply) || m.Has(hdrAutoRespond) {
+		return true
+	}
+	return strings.EqualFold(m.Get(hdrPrecedence), "auto_reply")
+}
@@ -0,0 +1,37 @@
+package mbox
+
+import (
+	"testing"
+)
+
+func TestIsVacation(t *testing.T) {
+	data := []struct {
+		File    string
+		Subject string
+		Drop    string
+		Want    bool
+	}{
+		{File: "vacation.txt", Want: true},
+		{File: "vacation.txt", Drop: "auto-submitted", Want: false},
+		{File: "vacation.txt", Drop: "in-reply-to", Want: true},
+		{File: "simple.txt", Want: false},
+		{File: "simple.txt", Subject: "Automatic reply: mbox test", Want: true},
+		{File: "reply.txt", Subject: "Re: out of office party", Want: false},
+	}
+	for _, d := range data {
+		m, err := openMessage(d.File)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", d.File, err)
+			continue
+		}
+		if d.Subject != "" {
+			m.Set("subject", d.Subject)
+		}
+		if d.Drop != "" {
+			m.Del(d.Drop)
+		}
+		if got := m.IsVacation(); got != d.Want {
+			t.Errorf("%s (%s): vacation mismatched! want %t, got %t", d.File, m.Subject(), d.Want, got)
+		}
+	}
+}
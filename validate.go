@@ -0,0 +1,103 @@
+package mbox
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMissingHeader      = errors.New("missing header")
+	ErrDuplicateHeader    = errors.New("header should occur once")
+	ErrInvalidDate        = errors.New("invalid date")
+	ErrInvalidAddress     = errors.New("invalid address")
+	ErrInvalidContentType = errors.New("invalid content type")
+	ErrBoundaryMismatch   = errors.New("boundary mismatch")
+)
+
+// uniqueHeaders are the fields that RFC 5322 allows at most once in a message.
+var uniqueHeaders = []string{
+	hdrDate,
+	hdrFrom,
+	hdrSender,
+	hdrReplyTo,
+	hdrTo,
+	hdrCc,
+	hdrBcc,
+	hdrMessageID,
+	hdrInReplyTo,
+	hdrReferences,
+	hdrSubject,
+}
+
+var addressHeaders = []string{
+	hdrFrom,
+	hdrSender,
+	hdrReplyTo,
+	hdrTo,
+	hdrCc,
+	hdrBcc,
+}
+
+// Validate checks that the message is well-formed and returns all the problems
+// found instead of stopping at the first one:
+//
+//   - the From and Date headers are present and occur only once, like the
+//     other fields limited by RFC 5322,
+//   - the Date header and the address headers can be parsed,
+//   - the Content-Type of the message and of its parts can be parsed,
+//   - the parts of a multipart message are delimited by its boundary and the
+//     closing delimiter is present, which can only be checked for the messages
+//     read with the Lenient option.
+//
+// The errors wrap one of the ErrXXX variables defined by this package.
+func (m Message) Validate() []error {
+	var list []error
+	for _, k := range []string{hdrFrom, hdrDate} {
+		if !m.Has(k) {
+			list = append(list, fmt.Errorf("%w: %s", ErrMissingHeader, k))
+		}
+	}
+	for _, k := range uniqueHeaders {
+		if n := len(m.Values(k)); n > 1 {
+			list = append(list, fmt.Errorf("%w: %s (%d times)", ErrDuplicateHeader, k, n))
+		}
+	}
+	if m.Has(hdrDate) {
+		if _, err := m.Header.Date(hdrDate); err != nil {
+			list = append(list, fmt.Errorf("%w: %s", ErrInvalidDate, m.Get(hdrDate)))
+		}
+	}
+	for _, k := range addressHeaders {
+		if !m.Has(k) {
+			continue
+		}
+		if _, err := m.AddressList(k); err != nil {
+			list = append(list, fmt.Errorf("%w: %s: %s", ErrInvalidAddress, k, m.Get(k)))
+		}
+	}
+	if m.Has(hdrContentType) {
+		if _, err := m.mediaType(); err != nil {
+			list = append(list, fmt.Errorf("%w: %s", ErrInvalidContentType, m.contentType()))
+		}
+	}
+	for _, p := range m.Parts {
+		if !p.Has(hdrContentType) {
+			continue
+		}
+		if _, err := p.mediaType(); err != nil {
+			list = append(list, fmt.Errorf("%w: part %s: %s", ErrInvalidContentType, p.path, p.contentType()))
+		}
+	}
+	if mt, ok := m.declaredMultipart(); ok {
+		switch b := mt.Params[multiBound]; {
+		case b == "":
+			list = append(list, fmt.Errorf("%w: missing boundary", ErrBoundaryMismatch))
+		case len(m.Parts) == 0:
+			list = append(list, fmt.Errorf("%w: no part delimited by %s", ErrBoundaryMismatch, b))
+		}
+	}
+	if m.unterminated {
+		list = append(list, fmt.Errorf("%w: missing closing delimiter", ErrUnterminatedPart))
+	}
+	return list
+}
@@ -0,0 +1,78 @@
+package mbox
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "invalid.txt"))
+	if err != nil {
+		t.Fatalf("fail to open mbox: %s", err)
+	}
+	defer r.Close()
+
+	want := []error{
+		ErrMissingHeader,
+		ErrMissingHeader,
+		ErrInvalidDate,
+		ErrInvalidAddress,
+		ErrDuplicateHeader,
+		ErrInvalidContentType,
+		ErrBoundaryMismatch,
+		ErrBoundaryMismatch,
+	}
+	var (
+		scan = NewScanner(r, Lenient())
+		i    int
+	)
+	for ; scan.Scan(); i++ {
+		m := scan.Message()
+		if i >= len(want) {
+			continue
+		}
+		errs := m.Validate()
+		if len(errs) != 1 {
+			t.Errorf("%s: wrong number of errors! want 1, got %d (%v)", m.Subject(), len(errs), errs)
+			continue
+		}
+		if !errors.Is(errs[0], want[i]) {
+			t.Errorf("%s: wrong error! want %s, got %s", m.Subject(), want[i], errs[0])
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to scan mbox: %s", err)
+	}
+	if i != len(want) {
+		t.Fatalf("wrong number of messages! want %d, got %d", len(want), i)
+	}
+}
+
+func TestValidateUnterminated(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", "unterminated.txt"))
+	if err != nil {
+		t.Fatalf("fail to open mbox: %s", err)
+	}
+	defer r.Close()
+
+	m, _ := ReadMessage(bufio.NewReader(r), Lenient())
+	errs := m.Validate()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrUnterminatedPart) {
+		t.Errorf("wrong errors! want %s, got %v", ErrUnterminatedPart, errs)
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	for _, f := range []string{"simple.txt", "mixed.txt", "alternative.txt"} {
+		m, err := openMessage(f)
+		if err != nil {
+			t.Fatalf("%s: fail to parse mbox: %s", f, err)
+		}
+		if errs := m.Validate(); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors: %v", f, errs)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSender = "MAILER-DAEMON"
+
+func WriteMessage(w io.Writer, m Message) error {
+	ws := bufio.NewWriter(w)
+	if strings.HasPrefix(m.FromLine, fromLinePrefix) {
+		ws.WriteString(m.FromLine + "\n")
+	} else {
+		writeFromLine(ws, m)
+	}
+	if err := writeMessage(ws, m); err != nil {
+		return err
+	}
+	ws.WriteString("\n")
+	return ws.Flush()
+}
+
+// ErrSkipMessage can be returned by the function given to Transform to drop
+// the current message from its output.
+var ErrSkipMessage = errors.New("skip message")
+
+// Transform reads the messages of r one at a time, gives them to fn and writes
+// them to w. fn can modify the message before it is written or return
+// ErrSkipMessage to drop it. Transform stops at the first other error returned
+// by fn. It returns the number of messages written.
+func Transform(w io.Writer, r io.Reader, fn func(*Message) error) (int, error) {
+	var (
+		scan = NewScanner(r)
+		n    int
+	)
+	for scan.Scan() {
+		m := scan.Message()
+		if err := fn(&m); err != nil {
+			if errors.Is(err, ErrSkipMessage) {
+				continue
+			}
+			return n, err
+		}
+		if err := WriteMessage(w, m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, scan.Err()
+}
+
+func writeFromLine(ws *bufio.Writer, m Message) {
+	var (
+		when   = m.Date()
+		sender = m.From()
+	)
+	if when.IsZero() {
+		when = time.Now().UTC()
+	}
+	if sender == "" {
+		sender = defaultSender
+	}
+	fmt.Fprintf(ws, "%s%s %s\n", fromLinePrefix, sender, when.Format(time.ANSIC))
+}
+
+func writeMessage(ws *bufio.Writer, m Message) error {
+	if !m.Has(hdrContentLength) {
+		writeHeader(ws, m.Header, m.Keys())
+		return writeContent(ws, m, writeBody)
+	}
+	// the escaped From lines change the length of the body.
+	var (
+		buf  bytes.Buffer
+		body = bufio.NewWriter(&buf)
+	)
+	if err := writeContent(body, m, writeBody); err != nil {
+		return err
+	}
+	body.Flush()
+
+	hdr := m.Header.Clone()
+	hdr.Set(hdrContentLength, strconv.Itoa(buf.Len()))
+	writeHeader(ws, hdr, m.Keys())
+	_, err := ws.Write(buf.Bytes())
+	return err
+}
+
+func writeContent(ws *bufio.Writer, m Message, write func(*bufio.Writer, []byte)) error {
+	if !m.IsMultipart() {
+		for _, p := range m.Parts {
+			write(ws, p.Body)
+		}
+		return nil
+	}
+	mt, err := m.mediaType()
+	if err != nil {
+		return err
+	}
+	tree := make(map[string]Part, len(m.Parts)+len(m.containers))
+	for _, p := range m.containers {
+		tree[p.path] = p
+	}
+	for _, p := range m.Parts {
+		tree[p.path] = p
+	}
+	write(ws, m.Preamble)
+	writeParts(ws, tree, "", mt.Params[multiBound], write)
+	write(ws, m.Epilog)
+	return nil
+}
+
+// writeParts writes the children of the part at path, delimited by boundary,
+// and the children of the containers among them with their own boundary.
+func writeParts(ws *bufio.Writer, tree map[string]Part, path, boundary string, write func(*bufio.Writer, []byte)) {
+	for _, p := range childParts(tree, path) {
+		ws.WriteString("--" + boundary + "\n")
+		writeHeader(ws, p.Header, p.Keys())
+		if p.IsMultipart() {
+			writeParts(ws, tree, p.path, p.Boundary(), write)
+			continue
+		}
+		write(ws, p.Body)
+	}
+	ws.WriteString("--" + boundary + "--\n")
+}
+
+func childParts(tree map[string]Part, path string) []Part {
+	var (
+		list   []Part
+		prefix string
+	)
+	if path != "" {
+		prefix = path + "."
+	}
+	for k, p := range tree {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if ok && !strings.Contains(rest, ".") {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return partIndex(list[i].path) < partIndex(list[j].path)
+	})
+	return list
+}
+
+func partIndex(path string) int {
+	if ix := strings.LastIndexByte(path, '.'); ix >= 0 {
+		path = path[ix+1:]
+	}
+	n, _ := strconv.Atoi(path)
+	return n
+}
+
+func writeHeader(ws *bufio.Writer, hdr Header, keys []string) {
+	for _, k := range keys {
+		for _, v := range hdr[k] {
+			fmt.Fprintf(ws, "%s: %s\n", k, v)
+		}
+	}
+	ws.WriteString("\n")
+}
+
+// writeBody writes body, quoting its lines starting with "From " as mboxo
+// does. Since the reader does not unquote them, the lines already quoted are
+// written as is so that rewriting a mailbox does not alter its bodies.
+func writeBody(ws *bufio.Writer, body []byte) {
+	var line []byte
+	for len(body) > 0 {
+		if ix := bytes.IndexByte(body, '\n'); ix >= 0 {
+			line, body = body[:ix+1], body[ix+1:]
+		} else {
+			line, body = body, nil
+		}
+		if bytes.HasPrefix(line, []byte(fromLinePrefix)) {
+			ws.WriteByte('>')
+		}
+		ws.Write(line)
+	}
+	if len(line) > 0 && line[len(line)-1] != '\n' {
+		ws.WriteByte('\n')
+	}
+}
+
+func writeLines(ws *bufio.Writer, body []byte) {
+	ws.Write(body)
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		ws.WriteByte('\n')
+	}
+}
+
+// mboxHeaders are the fields added to a message by the agents that delivered
+// it and by the mail clients that stored it in the mailbox.
+var mboxHeaders = []string{
+	"Status",
+	"X-Status",
+	"X-Keywords",
+	"X-Uid",
+	"X-Mozilla-Status",
+	"X-Mozilla-Status2",
+	"X-Mozilla-Keys",
+	"Content-Length",
+	"Lines",
+	"Return-Path",
+	"Delivered-To",
+}
+
+// OutboundHeader returns the header and the body of the message ready to be
+// sent again, eg with smtp.SendMail. The From line and the fields added when
+// the message was delivered and stored in the mailbox are removed. The body is
+// made of the original bytes of the message when it has been read with KeepRaw.
+func (m Message) OutboundHeader() (textproto.MIMEHeader, io.Reader, error) {
+	hdr := make(textproto.MIMEHeader, len(m.Header))
+	for k, vs := range m.Header {
+		hdr[textproto.CanonicalMIMEHeaderKey(k)] = append([]string(nil), vs...)
+	}
+	for _, k := range mboxHeaders {
+		hdr.Del(k)
+	}
+	if len(m.Raw) >= m.headerSize && m.headerSize > 0 {
+		body := m.Raw[m.headerSize:]
+		if bytes.HasSuffix(body, []byte("\r\n\r\n")) {
+			body = body[:len(body)-2]
+		} else if bytes.HasSuffix(body, []byte("\n\n")) {
+			body = body[:len(body)-1]
+		}
+		return hdr, bytes.NewReader(body), nil
+	}
+	var (
+		buf bytes.Buffer
+		ws  = bufio.NewWriter(&buf)
+	)
+	if err := writeContent(ws, m, writeLines); err != nil {
+		return nil, nil, err
+	}
+	if err := ws.Flush(); err != nil {
+		return nil, nil, err
+	}
+	return hdr, &buf, nil
+}
@@ -0,0 +1,320 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteMessage(t *testing.T) {
+	files := []string{
+		"simple.txt",
+		"alternative.txt",
+		"mixed.txt",
+		"mixedalt.txt",
+		"reply.txt",
+	}
+	for _, f := range files {
+		m, err := openMessage(f)
+		if err != nil {
+			t.Errorf("%s: fail to parse mbox: %s", f, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, m); err != nil {
+			t.Errorf("%s: fail to write message: %s", f, err)
+			continue
+		}
+		other, err := ReadMessage(bufio.NewReader(&buf))
+		if err != nil {
+			t.Errorf("%s: fail to parse written message: %s", f, err)
+			continue
+		}
+		if len(other.Parts) != len(m.Parts) {
+			t.Errorf("%s: wrong number of part! want %d, got %d", f, len(m.Parts), len(other.Parts))
+		}
+		if got, want := other.Subject(), m.Subject(); got != want {
+			t.Errorf("%s: wrong subject! want %s, got %s", f, want, got)
+		}
+		if got, want := other.TextBody(), m.TextBody(); got != want {
+			t.Errorf("%s: wrong text body! want %q, got %q", f, want, got)
+		}
+		if got, want := strings.Join(other.Keys(), ","), strings.Join(m.Keys(), ","); got != want {
+			t.Errorf("%s: wrong header order! want %s, got %s", f, want, got)
+		}
+	}
+}
+
+func TestWriteMessageNested(t *testing.T) {
+	m, err := openMessage("mixedalt.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, m); err != nil {
+		t.Fatalf("fail to write message: %s", err)
+	}
+	other, err := ReadMessage(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("fail to parse written message: %s", err)
+	}
+	if len(other.Parts) != len(m.Parts) {
+		t.Fatalf("wrong number of part! want %d, got %d", len(m.Parts), len(other.Parts))
+	}
+	for i, p := range m.Parts {
+		got := other.Parts[i]
+		if got.Path() != p.Path() {
+			t.Errorf("%d: wrong path! want %s, got %s", i, p.Path(), got.Path())
+		}
+		if !bytes.Equal(got.Body, p.Body) {
+			t.Errorf("%d: wrong body! want %q, got %q", i, p.Body, got.Body)
+		}
+	}
+}
+
+func TestWriteMessageEscapeFrom(t *testing.T) {
+	m := Message{
+		Header: make(Header),
+		Parts: []Part{
+			{Body: []byte("first line\nFrom here on\n>From there\n")},
+		},
+	}
+	m.Set("from", "midbel <midbel@foobar.org>")
+	m.Set("subject", defaultSubject)
+
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, m); err != nil {
+		t.Fatalf("fail to write message: %s", err)
+	}
+	want := "first line\n>From here on\n>From there\n\n"
+	if !bytes.HasSuffix(buf.Bytes(), []byte(want)) {
+		t.Errorf("From lines not escaped! want %q, got %q", want, buf.String())
+	}
+}
+
+func TestTransformIdentity(t *testing.T) {
+	body := ">From the past\n>>From the future\n"
+	src := "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: mbox test\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\n\n" +
+		body + "\n" +
+		"From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: mbox test\n\n" +
+		body + "\n"
+
+	got := src
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		if _, err := Transform(&buf, strings.NewReader(got), func(*Message) error { return nil }); err != nil {
+			t.Fatalf("fail to transform mbox: %s", err)
+		}
+		got = buf.String()
+	}
+	if got != src {
+		t.Errorf("transform altered the mbox! want %q, got %q", src, got)
+	}
+}
+
+func TestWriteMessageContentLength(t *testing.T) {
+	body := "From here on\nthe end\n"
+	src := "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"Subject: mbox test\n" +
+		"Content-Length: " + strconv.Itoa(len(body)) + "\n\n" +
+		body + "\n"
+	m, err := ReadMessage(bufio.NewReader(strings.NewReader(src)))
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, m); err != nil {
+		t.Fatalf("fail to write message: %s", err)
+	}
+	other, err := ReadMessage(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("fail to parse written message: %s", err)
+	}
+	want := ">" + body
+	if got := other.Get(hdrContentLength); got != strconv.Itoa(len(want)) {
+		t.Errorf("wrong content length! want %d, got %s", len(want), got)
+	}
+	if len(other.Parts) != 1 || string(other.Parts[0].Body) != want {
+		t.Errorf("wrong body! want %q, got %v", want, other.Parts)
+	}
+	if m.Get(hdrContentLength) != strconv.Itoa(len(body)) {
+		t.Errorf("header of the original message should not be modified")
+	}
+}
+
+func TestFromLine(t *testing.T) {
+	m, err := openMessage("simple.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	want := "From midbel@foobar.org Wed Jan 22 11:15:00 2020"
+	if m.FromLine != want {
+		t.Errorf("wrong From line! want %q, got %q", want, m.FromLine)
+	}
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, m); err != nil {
+		t.Fatalf("fail to write message: %s", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte(want+"\n")) {
+		t.Errorf("From line not written verbatim")
+	}
+}
+
+func TestOutboundHeader(t *testing.T) {
+	const msg = "From midbel@foobar.org Wed Jan 22 11:15:00 2020\n" +
+		"Return-Path: <midbel@foobar.org>\n" +
+		"Delivered-To: foobar@foobar.org\n" +
+		"From: midbel <midbel@foobar.org>\n" +
+		"To: foobar <foobar@foobar.org>\n" +
+		"Subject: mbox test\n" +
+		"Status: RO\n" +
+		"X-Status: A\n" +
+		"X-Mozilla-Status: 0001\n" +
+		"Content-Length: 21\n" +
+		"\n" +
+		"hello world\nsee you!\n" +
+		"\n"
+	for _, opts := range [][]Option{nil, {KeepRaw()}} {
+		m, err := ReadMessage(bufio.NewReader(strings.NewReader(msg)), opts...)
+		if err != nil {
+			t.Fatalf("fail to parse message: %s", err)
+		}
+		hdr, body, err := m.OutboundHeader()
+		if err != nil {
+			t.Fatalf("fail to get outbound header: %s", err)
+		}
+		for _, k := range []string{"Status", "X-Status", "X-Mozilla-Status", "Content-Length", "Return-Path", "Delivered-To"} {
+			if _, ok := hdr[k]; ok {
+				t.Errorf("%s should have been removed", k)
+			}
+		}
+		for _, k := range []string{"From", "To", "Subject"} {
+			if got, want := hdr.Get(k), m.Get(k); got != want {
+				t.Errorf("%s: wrong value! want %s, got %s", k, want, got)
+			}
+		}
+		bs, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("fail to read body: %s", err)
+		}
+		if want := "hello world\nsee you!\n"; string(bs) != want {
+			t.Errorf("wrong body! want %q, got %q", want, bs)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "dupes.txt"))
+	if err != nil {
+		t.Fatalf("fail to read testdata: %s", err)
+	}
+	var (
+		buf  bytes.Buffer
+		seen = make(map[string]struct{})
+	)
+	n, err := Transform(&buf, bytes.NewReader(src), func(m *Message) error {
+		if _, ok := seen[m.MessageID()]; ok {
+			return ErrSkipMessage
+		}
+		seen[m.MessageID()] = struct{}{}
+		m.Del("Received")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fail to transform mbox: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("wrong number of messages written! want %d, got %d", 2, n)
+	}
+	var (
+		scan = NewScanner(&buf)
+		ids  []string
+	)
+	for scan.Scan() {
+		m := scan.Message()
+		if m.Has("Received") {
+			t.Errorf("%s: Received header should have been removed", m.MessageID())
+		}
+		ids = append(ids, m.MessageID())
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatalf("fail to parse transformed mbox: %s", err)
+	}
+	want := []string{"1234@local.foobar.org", "5678@local.foobar.org"}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("messages mismatched! want %v, got %v", want, ids)
+	}
+
+	stop := errors.New("stop")
+	n, err = Transform(io.Discard, bytes.NewReader(src), func(m *Message) error {
+		return stop
+	})
+	if n != 0 || !errors.Is(err, stop) {
+		t.Errorf("transform should stop on error! got %d, %v", n, err)
+	}
+}
+
+func TestMapHeaders(t *testing.T) {
+	m, err := openMessage("mixed.txt")
+	if err != nil {
+		t.Fatalf("fail to parse mbox: %s", err)
+	}
+	m.Add("Received", "from mail.foobar.org by mx.foobar.org")
+	m.Add("X-Originating-Ip", "[10.0.0.1]")
+
+	var seen []string
+	m.MapHeaders(func(k string, vs []string) []string {
+		seen = append(seen, k)
+		switch k {
+		case "Received", "X-Originating-Ip", "Content-Type":
+			return nil
+		case "To":
+			return []string{"undisclosed-recipients:;"}
+		default:
+			return vs
+		}
+	})
+	for _, k := range seen {
+		if k == "Content-Type" || k == "Mime-Version" {
+			t.Errorf("%s should not be given for multipart messages", k)
+		}
+	}
+	for _, k := range []string{"Received", "X-Originating-Ip"} {
+		if m.Has(k) {
+			t.Errorf("%s should have been deleted", k)
+		}
+	}
+	if got := m.Get("To"); got != "undisclosed-recipients:;" {
+		t.Errorf("wrong to! want %s, got %s", "undisclosed-recipients:;", got)
+	}
+	if got := m.Subject(); got != defaultSubject {
+		t.Errorf("wrong subject! want %s, got %s", defaultSubject, got)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, m); err != nil {
+		t.Fatalf("fail to write message: %s", err)
+	}
+	other, err := ReadMessage(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("fail to parse written message: %s", err)
+	}
+	if len(other.Parts) != len(m.Parts) {
+		t.Errorf("wrong number of part! want %d, got %d", len(m.Parts), len(other.Parts))
+	}
+	if other.Has("Received") || other.Get("To") != "undisclosed-recipients:;" {
+		t.Errorf("headers not rewritten in written message")
+	}
+}